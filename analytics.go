@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// analyticsRow - строка данных графика: подпись и показатели продаж
+type analyticsRow struct {
+	Label   string
+	Units   int
+	Revenue decimal.Decimal
+	Share   string // доля в итоге по показателю графика, если график делит продажи целиком
+}
+
+// chartDef - описание графика панели аналитики
+type chartDef struct {
+	ID         string
+	Title      string
+	LabelTitle string // заголовок столбца подписей в таблице данных
+	Metric     string // units или revenue - что откладывается по оси значений
+	Horizontal bool   // горизонтальные полосы для рейтингов, вертикальные столбцы для периодов
+	WithShare  bool
+	Label      string // выражение подписи; {period} заменяется на выражение периода
+	GroupBy    string
+	OrderBy    string
+	Top        int
+}
+
+var chartDefs = []chartDef{
+	{ID: "revenue", Title: "Выручка по периодам", LabelTitle: "Период", Metric: "revenue",
+		Label: "{period}", GroupBy: "{period}", OrderBy: "Label"},
+	{ID: "units", Title: "Продано экземпляров по периодам", LabelTitle: "Период", Metric: "units",
+		Label: "{period}", GroupBy: "{period}", OrderBy: "Label"},
+	{ID: "top_books", Title: "Самые продаваемые книги", LabelTitle: "Книга", Metric: "units", Horizontal: true,
+		Label: "COALESCE(b.Name, CAST(s.BookID AS nvarchar(20)))", GroupBy: "s.BookID, b.Name", OrderBy: "Units DESC", Top: 10},
+	{ID: "top_publishers", Title: "Издательства с наибольшей выручкой", LabelTitle: "Издательство", Metric: "revenue", Horizontal: true,
+		Label: "COALESCE(p.Name, CAST(s.PublisherID AS nvarchar(20)))", GroupBy: "s.PublisherID, p.Name", OrderBy: "Revenue DESC", Top: 10},
+	{ID: "sections", Title: "Продажи по разделам классификатора", LabelTitle: "Раздел", Metric: "revenue", Horizontal: true, WithShare: true,
+		Label: "COALESCE(c.Name, N'без раздела')", GroupBy: "c.Name", OrderBy: "Revenue DESC"},
+	{ID: "preorders", Title: "Доля продаж по предварительным заказам", LabelTitle: "Тип продажи", Metric: "units", Horizontal: true, WithShare: true,
+		Label: "CASE WHEN s.IsOrder = 1 THEN N'по заказу' ELSE N'без заказа' END", GroupBy: "s.IsOrder", OrderBy: "Label DESC"},
+}
+
+// periodExprs - выражения периода для группировки; неделя начинается с понедельника независимо от DATEFIRST
+var periodExprs = map[string]string{
+	"day":   "CONVERT(nvarchar(10), CAST(s.SaleDate AS date), 23)",
+	"week":  "CONVERT(nvarchar(10), DATEADD(day, -((DATEPART(weekday, s.SaleDate) + @@DATEFIRST - 2) % 7), CAST(s.SaleDate AS date)), 23)",
+	"month": "CONVERT(nvarchar(7), s.SaleDate, 23)",
+}
+
+// findChart ищет график по id
+func findChart(id string) *chartDef {
+	for i := range chartDefs {
+		if chartDefs[i].ID == id {
+			return &chartDefs[i]
+		}
+	}
+	return nil
+}
+
+// loadChart выбирает данные графика за период; group - day, week или month
+func loadChart(ctx context.Context, cd *chartDef, r dateRange, group string) ([]analyticsRow, error) {
+	period := periodExprs[group]
+	top := ""
+	if cd.Top > 0 {
+		top = fmt.Sprintf("TOP %d ", cd.Top)
+	}
+	query := `
+        SELECT ` + top + strings.ReplaceAll(cd.Label, "{period}", period) + ` AS Label,
+               SUM(s.Quantity) AS Units, SUM(` + salesRevenueExpr + `) AS Revenue
+        FROM Sales s
+        ` + salesPriceJoin + `
+        LEFT JOIN Books b ON b.BookCode = s.BookID
+        LEFT JOIN Publishers p ON p.PublisherCode = s.PublisherID
+        LEFT JOIN Classifier c ON c.ClassifierCode = b.ClassifierCode
+        WHERE s.SaleDate >= ? AND s.SaleDate < ?
+        GROUP BY ` + strings.ReplaceAll(cd.GroupBy, "{period}", period) + `
+        ORDER BY ` + cd.OrderBy
+	var rows []analyticsRow
+	if err := db().WithContext(ctx).Raw(query, r.From, r.end()).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if strings.Contains(cd.GroupBy, "{period}") {
+		rows = fillPeriods(rows, periodLabels(r, group))
+	}
+	if cd.WithShare {
+		total := decimal.Zero
+		for _, row := range rows {
+			total = total.Add(cd.value(row))
+		}
+		for i := range rows {
+			if !total.IsZero() {
+				rows[i].Share = cd.value(rows[i]).Div(total).Mul(decimal.NewFromInt(100)).StringFixed(1) + "%"
+			}
+		}
+	}
+	return rows, nil
+}
+
+// periodLabels перечисляет подписи всех периодов диапазона в том же виде, что и periodExprs
+func periodLabels(r dateRange, group string) []string {
+	var labels []string
+	switch group {
+	case "week":
+		start := r.From.AddDate(0, 0, -((int(r.From.Weekday()) + 6) % 7))
+		for d := start; !d.After(r.To); d = d.AddDate(0, 0, 7) {
+			labels = append(labels, d.Format("2006-01-02"))
+		}
+	case "month":
+		start := time.Date(r.From.Year(), r.From.Month(), 1, 0, 0, 0, 0, r.From.Location())
+		for d := start; !d.After(r.To); d = d.AddDate(0, 1, 0) {
+			labels = append(labels, d.Format("2006-01"))
+		}
+	default:
+		for d := r.From; !d.After(r.To); d = d.AddDate(0, 0, 1) {
+			labels = append(labels, d.Format("2006-01-02"))
+		}
+	}
+	return labels
+}
+
+// fillPeriods дополняет данные графика периодами без продаж, чтобы провалы были видны на оси
+func fillPeriods(rows []analyticsRow, labels []string) []analyticsRow {
+	byLabel := make(map[string]analyticsRow, len(rows))
+	for _, row := range rows {
+		byLabel[row.Label] = row
+	}
+	filled := make([]analyticsRow, 0, len(labels))
+	for _, label := range labels {
+		row := byLabel[label]
+		row.Label = label
+		filled = append(filled, row)
+	}
+	return filled
+}
+
+// value - показатель строки, откладываемый на графике
+func (cd *chartDef) value(row analyticsRow) decimal.Decimal {
+	if cd.Metric == "units" {
+		return decimal.NewFromInt(int64(row.Units))
+	}
+	return row.Revenue
+}
+
+// formatValue форматирует показатель для подписи на графике
+func (cd *chartDef) formatValue(v decimal.Decimal) string {
+	if cd.Metric == "units" {
+		return v.StringFixed(0)
+	}
+	return v.StringFixed(2)
+}
+
+// resultSet представляет данные графика таблицей для выгрузки
+func (cd *chartDef) resultSet(rows []analyticsRow) *resultSet {
+	rs := &resultSet{Title: cd.Title, Columns: []string{cd.LabelTitle, "Экземпляров", "Выручка"}, BookColumn: -1}
+	if cd.WithShare {
+		rs.Columns = append(rs.Columns, "Доля")
+	}
+	for _, row := range rows {
+		record := []interface{}{row.Label, row.Units, row.Revenue.StringFixed(2)}
+		if cd.WithShare {
+			record = append(record, row.Share)
+		}
+		rs.Rows = append(rs.Rows, record)
+	}
+	return rs
+}
+
+const (
+	chartWidth     = 760
+	chartHeight    = 240
+	chartMargin    = 40
+	chartBarHeight = 22
+	chartLabelArea = 220
+)
+
+// svg строит график в SVG на сервере, чтобы страница не зависела от внешних скриптов
+func (cd *chartDef) svg(rows []analyticsRow) template.HTML {
+	if len(rows) == 0 {
+		return ""
+	}
+	maxValue := decimal.Zero
+	for _, row := range rows {
+		if v := cd.value(row); v.GreaterThan(maxValue) {
+			maxValue = v
+		}
+	}
+	if maxValue.IsZero() {
+		maxValue = decimal.NewFromInt(1)
+	}
+	var b strings.Builder
+	if cd.Horizontal {
+		barArea := chartWidth - chartLabelArea - 100
+		height := len(rows)*chartBarHeight + 10
+		fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`, chartWidth, height)
+		for i, row := range rows {
+			v := cd.value(row)
+			width, _ := v.Div(maxValue).Mul(decimal.NewFromInt(int64(barArea))).Float64()
+			y := i*chartBarHeight + 5
+			fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartLabelArea-6, y+15, html.EscapeString(shortLabel(row.Label, 32)))
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="#4a7ebb"><title>%s</title></rect>`,
+				chartLabelArea, y+2, width, chartBarHeight-6, html.EscapeString(row.Label))
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d">%s</text>`, float64(chartLabelArea)+width+6, y+15, cd.formatValue(v))
+		}
+	} else {
+		plotWidth := chartWidth - 2*chartMargin
+		plotHeight := chartHeight - 2*chartMargin
+		step := float64(plotWidth) / float64(len(rows))
+		// Подписываем не больше 12 периодов, чтобы подписи не налезали друг на друга
+		every := (len(rows) + 11) / 12
+		fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`, chartWidth, chartHeight)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#888"/>`, chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, chartMargin, chartMargin-8, cd.formatValue(maxValue))
+		for i, row := range rows {
+			v := cd.value(row)
+			h, _ := v.Div(maxValue).Mul(decimal.NewFromInt(int64(plotHeight))).Float64()
+			x := float64(chartMargin) + float64(i)*step
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4a7ebb"><title>%s: %s</title></rect>`,
+				x+1, float64(chartHeight-chartMargin)-h, step-2, h, html.EscapeString(row.Label), cd.formatValue(v))
+			if i%every == 0 {
+				fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x+step/2, chartHeight-chartMargin+16, html.EscapeString(row.Label))
+			}
+		}
+	}
+	b.WriteString(`</svg>`)
+	// Все подписи экранированы выше
+	return template.HTML(b.String())
+}
+
+// shortLabel обрезает длинную подпись по символам, а не байтам
+func shortLabel(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// chartView - график с данными для шаблона
+type chartView struct {
+	Def   *chartDef
+	Rows  []analyticsRow
+	SVG   template.HTML
+	Error string
+}
+
+// analyticsGroup читает группировку периодов; по умолчанию - по дням
+func analyticsGroup(q url.Values) string {
+	if _, ok := periodExprs[q.Get("group")]; ok {
+		return q.Get("group")
+	}
+	return "day"
+}
+
+// renderAnalytics выводит панель аналитики продаж за период
+func renderAnalytics(ctx context.Context, w http.ResponseWriter, r dateRange, group, message string) {
+	data := map[string]interface{}{"Message": message, "Range": r, "Group": group}
+	if currentRole != "admin" {
+		data["Message"] = "Аналитика продаж доступна только администратору."
+		if err := tmpl.ExecuteTemplate(w, "analytics.html", data); err != nil {
+			http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	var charts []chartView
+	for i := range chartDefs {
+		cd := &chartDefs[i]
+		view := chartView{Def: cd}
+		rows, err := loadChart(ctx, cd, r, group)
+		if err != nil {
+			view.Error = "Ошибка получения данных: " + describeQueryError(ctx, err)
+		} else {
+			view.Rows = rows
+			view.SVG = cd.svg(rows)
+		}
+		charts = append(charts, view)
+	}
+	data["Charts"] = charts
+	if err := tmpl.ExecuteTemplate(w, "analytics.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerAnalyticsHandlers() {
+	http.HandleFunc("/analytics", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		period, err := parseDateRange(q)
+		if err != nil {
+			period, _ = parseDateRange(url.Values{})
+			renderAnalytics(ctx, w, period, analyticsGroup(q), "Ошибка в периоде: "+err.Error())
+			return
+		}
+		renderAnalytics(ctx, w, period, analyticsGroup(q), "")
+	})
+
+	// выгрузка таблицы данных одного графика
+	http.HandleFunc("/analytics_export", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		period, err := parseDateRange(q)
+		cd := findChart(q.Get("chart"))
+		if err != nil || cd == nil || currentRole != "admin" {
+			period, _ = parseDateRange(url.Values{})
+			renderAnalytics(ctx, w, period, "day", "Некорректный график или период.")
+			return
+		}
+		rows, err := loadChart(ctx, cd, period, analyticsGroup(q))
+		if err != nil {
+			renderAnalytics(ctx, w, period, analyticsGroup(q), "Ошибка получения данных: "+describeQueryError(ctx, err))
+			return
+		}
+		filename := fmt.Sprintf("%s_%s_%s.csv", cd.ID, period.From.Format("20060102"), period.To.Format("20060102"))
+		setDownloadHeaders(w, filename, "text/csv; charset=utf-8")
+		writeCSV(w, []*resultSet{cd.resultSet(rows)})
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPeriodLabels(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		from, to string
+		group    string
+		want     []string
+	}{
+		{"2024-02-27", "2024-03-01", "day", []string{"2024-02-27", "2024-02-28", "2024-02-29", "2024-03-01"}},
+		{"2024-03-01", "2024-03-01", "day", []string{"2024-03-01"}},
+		// 2024-03-06 - среда, неделя начинается с понедельника 2024-03-04
+		{"2024-03-06", "2024-03-18", "week", []string{"2024-03-04", "2024-03-11", "2024-03-18"}},
+		{"2024-03-04", "2024-03-10", "week", []string{"2024-03-04"}},
+		// 2024-03-10 - воскресенье, относится к неделе с 2024-03-04
+		{"2024-03-10", "2024-03-11", "week", []string{"2024-03-04", "2024-03-11"}},
+		{"2024-01-31", "2024-04-01", "month", []string{"2024-01", "2024-02", "2024-03", "2024-04"}},
+		{"2023-12-15", "2024-01-15", "month", []string{"2023-12", "2024-01"}},
+	}
+	for _, tt := range tests {
+		got := periodLabels(dateRange{From: day(tt.from), To: day(tt.to)}, tt.group)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("periodLabels(%s..%s, %s) = %v, want %v", tt.from, tt.to, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestFillPeriods(t *testing.T) {
+	rows := []analyticsRow{
+		{Label: "2024-01", Units: 3, Revenue: decimal.NewFromInt(300)},
+		{Label: "2024-03", Units: 1, Revenue: decimal.NewFromInt(100)},
+	}
+	got := fillPeriods(rows, []string{"2024-01", "2024-02", "2024-03", "2024-04"})
+	if len(got) != 4 {
+		t.Fatalf("ожидалось 4 периода, получено %d", len(got))
+	}
+	wantUnits := []int{3, 0, 1, 0}
+	for i, row := range got {
+		if row.Units != wantUnits[i] {
+			t.Errorf("период %s: Units = %d, want %d", row.Label, row.Units, wantUnits[i])
+		}
+	}
+	if got[1].Label != "2024-02" || !got[1].Revenue.IsZero() {
+		t.Errorf("пустой период = %+v, want 2024-02 с нулевой выручкой", got[1])
+	}
+}
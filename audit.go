@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// auditEntry - запись журнала изменений, сделанных через приложение
+type auditEntry struct {
+	ID        uint      `gorm:"primaryKey"`
+	At        time.Time `gorm:"index"`
+	Login     string    `gorm:"size:100"`
+	Action    string    `gorm:"size:50"`
+	Entity    string    `gorm:"size:50;index"`
+	EntityKey string    `gorm:"size:100"`
+	Details   string    `gorm:"size:1000"`
+}
+
+func (auditEntry) TableName() string { return "app_audit_log" }
+
+func init() {
+	registerModels(&auditEntry{})
+}
+
+// writeAudit добавляет запись в журнал в рамках транзакции tx
+func writeAudit(tx *gorm.DB, action, entity, key, details string) error {
+	return tx.Create(&auditEntry{
+		At:        time.Now(),
+		Login:     currentUser,
+		Action:    action,
+		Entity:    entity,
+		EntityKey: key,
+		Details:   details,
+	}).Error
+}
+
+// renderAuditLog выводит последние записи журнала изменений
+func renderAuditLog(ctx context.Context, w http.ResponseWriter, entity string) {
+	var entries []auditEntry
+	q := db().WithContext(ctx).Order("at DESC").Limit(500)
+	if entity != "" {
+		q = q.Where("entity = ?", entity)
+	}
+	message := "Последние изменения."
+	if err := q.Find(&entries).Error; err != nil {
+		message = "Ошибка получения журнала: " + describeQueryError(ctx, err)
+	}
+	data := map[string]interface{}{
+		"Message": message,
+		"Entity":  entity,
+		"Entries": entries,
+	}
+	if err := tmpl.ExecuteTemplate(w, "audit_log.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerAuditHandlers() {
+	http.HandleFunc("/audit_log", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if currentRole != "admin" {
+			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Журнал изменений доступен только администратору."})
+			return
+		}
+		renderAuditLog(ctx, w, r.URL.Query().Get("entity"))
+	})
+}
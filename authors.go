@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// authorSummary - автор в списке с числом вариантов имени и книг
+type authorSummary struct {
+	AuthorID int
+	FullName string
+	Variants int
+	Books    int
+}
+
+// authorBook - книга автора
+type authorBook struct {
+	BookCode      int
+	Name          string
+	PublisherName string
+}
+
+// listAuthors возвращает авторов, у которых основное имя или один из вариантов содержит name
+func listAuthors(ctx context.Context, name string) ([]authorSummary, error) {
+	query := `
+        SELECT a.AuthorID, a.FullName,
+               (SELECT COUNT(*) FROM AuthorNames n WHERE n.AuthorID = a.AuthorID AND n.FullName <> a.FullName) AS Variants,
+               (SELECT COUNT(*) FROM Books b WHERE b.AuthorID = a.AuthorID) AS Books
+        FROM Authors a`
+	var args []interface{}
+	if name != "" {
+		query += `
+        WHERE a.FullName LIKE ? OR EXISTS (SELECT 1 FROM AuthorNames n WHERE n.AuthorID = a.AuthorID AND n.FullName LIKE ?)`
+		pattern := "%" + escapeLike(name) + "%"
+		args = append(args, pattern, pattern)
+	}
+	query += " ORDER BY a.FullName"
+	var authors []authorSummary
+	err := db().WithContext(ctx).Raw(query, args...).Scan(&authors).Error
+	return authors, err
+}
+
+// authorFullName возвращает основное имя автора
+func authorFullName(tx *gorm.DB, authorID int) (string, error) {
+	var names []string
+	if err := tx.Raw("SELECT FullName FROM Authors WHERE AuthorID = ?", authorID).Scan(&names).Error; err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("автор %d не найден", authorID)
+	}
+	return names[0], nil
+}
+
+// addAuthorVariant добавляет вариант имени, если у автора его еще нет
+func addAuthorVariant(ctx context.Context, authorID int, variant string) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fullName, err := authorFullName(tx, authorID)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(fullName, variant) {
+			return errors.New("вариант совпадает с основным именем")
+		}
+		res := tx.Exec(`
+            INSERT INTO AuthorNames (AuthorID, FullName)
+            SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM AuthorNames WHERE AuthorID = ? AND FullName = ?)`,
+			authorID, variant, authorID, variant)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("такой вариант имени уже есть")
+		}
+		return writeAudit(tx, "add_variant", "author", strconv.Itoa(authorID), variant)
+	})
+}
+
+// deleteAuthorVariant удаляет вариант имени автора
+func deleteAuthorVariant(ctx context.Context, authorID int, variant string) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM AuthorNames WHERE AuthorID = ? AND FullName = ?", authorID, variant).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, "delete_variant", "author", strconv.Itoa(authorID), variant)
+	})
+}
+
+// makeVariantPrimary делает вариант основным именем, а прежнее основное имя сохраняет вариантом
+func makeVariantPrimary(ctx context.Context, authorID int, variant string) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fullName, err := authorFullName(tx, authorID)
+		if err != nil {
+			return err
+		}
+		// Сначала меняем вариант: если его нет, основное имя не трогаем
+		res := tx.Exec("UPDATE AuthorNames SET FullName = ? WHERE AuthorID = ? AND FullName = ?", fullName, authorID, variant)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return fmt.Errorf("вариант имени «%s» не найден", variant)
+		}
+		if err := tx.Exec("UPDATE Authors SET FullName = ? WHERE AuthorID = ?", variant, authorID).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, "rename", "author", strconv.Itoa(authorID), fullName+" → "+variant)
+	})
+}
+
+// mergeAuthors переносит книги и варианты имени автора-дубликата на основного автора и удаляет дубликат.
+// Имя дубликата сохраняется как вариант имени, чтобы поиск по нему продолжал находить книги.
+func mergeAuthors(ctx context.Context, targetID, duplicateID int) error {
+	if targetID == duplicateID {
+		return errors.New("нельзя объединить автора с самим собой")
+	}
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		targetName, err := authorFullName(tx, targetID)
+		if err != nil {
+			return err
+		}
+		duplicateName, err := authorFullName(tx, duplicateID)
+		if err != nil {
+			return err
+		}
+		moved := tx.Exec("UPDATE Books SET AuthorID = ? WHERE AuthorID = ?", targetID, duplicateID)
+		if moved.Error != nil {
+			return moved.Error
+		}
+		err = tx.Exec(`
+            INSERT INTO AuthorNames (AuthorID, FullName)
+            SELECT DISTINCT ?, x.FullName
+            FROM (SELECT FullName FROM Authors WHERE AuthorID = ?
+                  UNION SELECT FullName FROM AuthorNames WHERE AuthorID = ?) x
+            WHERE x.FullName <> ?
+              AND NOT EXISTS (SELECT 1 FROM AuthorNames n WHERE n.AuthorID = ? AND n.FullName = x.FullName)`,
+			targetID, duplicateID, duplicateID, targetName, targetID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM AuthorNames WHERE AuthorID = ?", duplicateID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM Authors WHERE AuthorID = ?", duplicateID).Error; err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%d %s → %d %s, книг перенесено: %d", duplicateID, duplicateName, targetID, targetName, moved.RowsAffected)
+		return writeAudit(tx, "merge", "author", strconv.Itoa(targetID), details)
+	})
+}
+
+// renderAuthors выводит список авторов
+func renderAuthors(ctx context.Context, w http.ResponseWriter, name, message string) {
+	authors, err := listAuthors(ctx, name)
+	if err != nil {
+		message = "Ошибка получения авторов: " + describeQueryError(ctx, err)
+	}
+	data := map[string]interface{}{
+		"Message": message,
+		"Name":    name,
+		"Authors": authors,
+	}
+	if err := tmpl.ExecuteTemplate(w, "authors.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderAuthor выводит автора с вариантами имени, книгами и формой объединения
+func renderAuthor(ctx context.Context, w http.ResponseWriter, authorID int, message string) {
+	fullName, err := authorFullName(db().WithContext(ctx), authorID)
+	if err != nil {
+		renderAuthors(ctx, w, "", "Ошибка получения автора: "+describeQueryError(ctx, err))
+		return
+	}
+	var variants []string
+	err = db().WithContext(ctx).Raw(
+		"SELECT FullName FROM AuthorNames WHERE AuthorID = ? AND FullName <> ? ORDER BY FullName", authorID, fullName).Scan(&variants).Error
+	if err != nil {
+		message = "Ошибка получения вариантов имени: " + describeQueryError(ctx, err)
+	}
+	var books []authorBook
+	err = db().WithContext(ctx).Raw(`
+        SELECT b.BookCode, b.Name, COALESCE(p.Name, '') AS PublisherName
+        FROM Books b
+        LEFT JOIN Publishers p ON p.PublisherCode = b.PublisherCode
+        WHERE b.AuthorID = ?
+        ORDER BY b.Name`, authorID).Scan(&books).Error
+	if err != nil {
+		message = "Ошибка получения книг: " + describeQueryError(ctx, err)
+	}
+	// Кандидаты в дубликаты - авторы с совпадающей фамилией (первым словом имени)
+	var candidates []authorSummary
+	if surname := strings.Fields(fullName); len(surname) > 0 {
+		candidates, _ = listAuthors(ctx, surname[0])
+	}
+	for i := 0; i < len(candidates); i++ {
+		if candidates[i].AuthorID == authorID {
+			candidates = append(candidates[:i], candidates[i+1:]...)
+			break
+		}
+	}
+
+	data := map[string]interface{}{
+		"Message":    message,
+		"IsAdmin":    currentRole == "admin",
+		"AuthorID":   authorID,
+		"FullName":   fullName,
+		"Variants":   variants,
+		"Books":      books,
+		"Candidates": candidates,
+	}
+	if err := tmpl.ExecuteTemplate(w, "author_view.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerAuthorHandlers() {
+	http.HandleFunc("/authors", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderAuthors(ctx, w, strings.TrimSpace(r.URL.Query().Get("name")), "Авторы и варианты их имен.")
+	})
+
+	http.HandleFunc("/author", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		authorID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderAuthors(ctx, w, "", "Некорректный код автора.")
+			return
+		}
+		renderAuthor(ctx, w, authorID, "")
+	})
+
+	// изменение вариантов имени и объединение авторов
+	http.HandleFunc("/author_update", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderAuthors(ctx, w, "", "Ошибка при обработке формы.")
+			return
+		}
+		authorID, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			renderAuthors(ctx, w, "", "Некорректный код автора.")
+			return
+		}
+		variant := strings.TrimSpace(r.FormValue("variant"))
+
+		var message string
+		switch r.FormValue("action") {
+		case "add_variant":
+			if variant == "" {
+				renderAuthor(ctx, w, authorID, "Введите вариант имени.")
+				return
+			}
+			err = addAuthorVariant(ctx, authorID, variant)
+			message = "✅ Вариант имени добавлен."
+		case "delete_variant":
+			err = deleteAuthorVariant(ctx, authorID, variant)
+			message = "✅ Вариант имени удален."
+		case "make_primary":
+			err = makeVariantPrimary(ctx, authorID, variant)
+			message = "✅ Основное имя изменено."
+		case "merge":
+			duplicateID, convErr := strconv.Atoi(r.FormValue("duplicateId"))
+			if convErr != nil {
+				renderAuthor(ctx, w, authorID, "Укажите код автора-дубликата.")
+				return
+			}
+			err = mergeAuthors(ctx, authorID, duplicateID)
+			message = "✅ Авторы объединены, книги перенесены."
+		default:
+			renderAuthor(ctx, w, authorID, "Неизвестное действие.")
+			return
+		}
+		if err != nil {
+			renderAuthor(ctx, w, authorID, "Ошибка изменения автора: "+describeQueryError(ctx, err))
+			return
+		}
+		invalidateSearchIndex()
+		renderAuthor(ctx, w, authorID, message)
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const cataloguePageSize = 50
+
+// bookCard - сводные данные о книге из Books, Publishers, Classifier и Warehouse
+type bookCard struct {
+	BookCode       int
+	Name           string
+	PublisherCode  int
+	PublisherName  string
+	ClassifierCode string
+	ClassifierName string
+	Price          *decimal.Decimal
+	NumberOfCopies *int
+}
+
+// bookAuthor - автор книги со всеми вариантами имени
+type bookAuthor struct {
+	AuthorID int
+	FullName string
+	Variants []string
+}
+
+const bookCardSelect = `
+    SELECT b.BookCode, b.Name, b.PublisherCode, COALESCE(p.Name, '') AS PublisherName,
+           CAST(b.ClassifierCode AS nvarchar(50)) AS ClassifierCode, COALESCE(c.Name, '') AS ClassifierName,
+           w.Price, w.NumberOfCopies
+    FROM Books b
+    LEFT JOIN Publishers p ON p.PublisherCode = b.PublisherCode
+    LEFT JOIN Classifier c ON c.ClassifierCode = b.ClassifierCode
+    LEFT JOIN Warehouse w ON w.BookCode = b.BookCode`
+
+// catalogueFilter - условия отбора в каталоге
+type catalogueFilter struct {
+	Name           string
+	PublisherCode  string
+	ClassifierCode string
+	InStockOnly    bool
+	Page           int
+}
+
+// loadCatalogue возвращает страницу каталога и признак наличия следующей страницы
+func loadCatalogue(ctx context.Context, f catalogueFilter) ([]bookCard, bool, error) {
+	var conditions []string
+	var args []interface{}
+	if f.Name != "" {
+		conditions = append(conditions, "b.Name LIKE ?")
+		args = append(args, "%"+f.Name+"%")
+	}
+	if f.PublisherCode != "" {
+		conditions = append(conditions, "b.PublisherCode = ?")
+		args = append(args, f.PublisherCode)
+	}
+	if f.ClassifierCode != "" {
+		conditions = append(conditions, "b.ClassifierCode = ?")
+		args = append(args, f.ClassifierCode)
+	}
+	if f.InStockOnly {
+		conditions = append(conditions, "w.NumberOfCopies > 0")
+	}
+	query := bookCardSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY b.Name OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
+	args = append(args, f.Page*cataloguePageSize, cataloguePageSize+1)
+
+	var books []bookCard
+	if err := db().WithContext(ctx).Raw(query, args...).Scan(&books).Error; err != nil {
+		return nil, false, err
+	}
+	hasNext := len(books) > cataloguePageSize
+	if hasNext {
+		books = books[:cataloguePageSize]
+	}
+	return books, hasNext, nil
+}
+
+// loadBookAuthors возвращает авторов книги с вариантами имени из AuthorNames
+func loadBookAuthors(ctx context.Context, bookCode int) ([]bookAuthor, error) {
+	var rows []struct {
+		AuthorID int
+		FullName string
+		Variant  *string
+	}
+	err := db().WithContext(ctx).Raw(`
+        SELECT a.AuthorID, a.FullName, n.FullName AS Variant
+        FROM Books b
+        JOIN Authors a ON a.AuthorID = b.AuthorID
+        LEFT JOIN AuthorNames n ON n.AuthorID = a.AuthorID AND n.FullName <> a.FullName
+        WHERE b.BookCode = ?
+        ORDER BY a.FullName, n.FullName`, bookCode).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var authors []bookAuthor
+	for _, row := range rows {
+		if len(authors) == 0 || authors[len(authors)-1].AuthorID != row.AuthorID {
+			authors = append(authors, bookAuthor{AuthorID: row.AuthorID, FullName: row.FullName})
+		}
+		if row.Variant != nil {
+			a := &authors[len(authors)-1]
+			a.Variants = append(a.Variants, *row.Variant)
+		}
+	}
+	return authors, nil
+}
+
+// queryResultSet выполняет запрос и возвращает набор строк с сохранением порядка столбцов
+func queryResultSet(ctx context.Context, title, query string, args ...interface{}) (*resultSet, error) {
+	rows, err := db().WithContext(ctx).Raw(query, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rs, err := scanResultSet(rows)
+	if err != nil {
+		return nil, err
+	}
+	rs.Title = title
+	return rs, nil
+}
+
+// renderBook выводит карточку книги
+func renderBook(ctx context.Context, w http.ResponseWriter, bookCode int) {
+	var card bookCard
+	data := map[string]interface{}{"IsAdmin": currentRole == "admin"}
+	err := db().WithContext(ctx).Raw(bookCardSelect+" WHERE b.BookCode = ?", bookCode).Scan(&card).Error
+	if err != nil || card.BookCode == 0 {
+		message := "Книга не найдена."
+		if err != nil {
+			message = "Ошибка получения книги: " + describeQueryError(ctx, err)
+		}
+		renderCatalogue(ctx, w, catalogueFilter{}, message)
+		return
+	}
+	data["Book"] = card
+
+	var messages []string
+	if authors, err := loadBookAuthors(ctx, bookCode); err != nil {
+		messages = append(messages, "Ошибка получения авторов: "+describeQueryError(ctx, err))
+	} else {
+		data["Authors"] = authors
+	}
+	if editions, err := queryResultSet(ctx, "Издания", "SELECT * FROM Editions WHERE BookCode = ?", bookCode); err != nil {
+		messages = append(messages, "Ошибка получения изданий: "+describeQueryError(ctx, err))
+	} else {
+		data["Editions"] = editions
+	}
+	if history, err := priceHistory(ctx, bookCode); err != nil {
+		messages = append(messages, "Ошибка получения истории цен: "+describeQueryError(ctx, err))
+	} else {
+		data["PriceHistory"] = history
+	}
+	// Таблица Sales доступна только администратору
+	if currentRole == "admin" {
+		sales, err := queryResultSet(ctx, "Последние продажи", `
+            SELECT TOP 20 s.SaleDate AS [Дата], e.FullName AS [Продавец], s.Quantity AS [Кол-во],
+                   CASE WHEN s.IsOrder = 1 THEN N'по заказу' ELSE N'' END AS [Тип]
+            FROM Sales s
+            LEFT JOIN Employees e ON e.EmployeeID = s.EmployeeID
+            WHERE s.BookID = ?
+            ORDER BY s.SaleDate DESC`, bookCode)
+		if err != nil {
+			messages = append(messages, "Ошибка получения продаж: "+describeQueryError(ctx, err))
+		} else {
+			data["Sales"] = sales
+		}
+	}
+	data["Message"] = strings.Join(messages, " ")
+	if err := tmpl.ExecuteTemplate(w, "book_view.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderCatalogue выводит каталог книг с фильтрами
+func renderCatalogue(ctx context.Context, w http.ResponseWriter, f catalogueFilter, message string) {
+	books, hasNext, err := loadCatalogue(ctx, f)
+	if err != nil {
+		message = "Ошибка получения каталога: " + describeQueryError(ctx, err)
+	}
+	var publishers []struct {
+		PublisherCode string
+		Name          string
+	}
+	db().WithContext(ctx).Raw("SELECT CAST(PublisherCode AS nvarchar(50)) AS PublisherCode, Name FROM Publishers ORDER BY Name").Scan(&publishers)
+	var sections []struct {
+		ClassifierCode string
+		Name           string
+	}
+	db().WithContext(ctx).Raw("SELECT CAST(ClassifierCode AS nvarchar(50)) AS ClassifierCode, Name FROM Classifier ORDER BY Name").Scan(&sections)
+
+	data := map[string]interface{}{
+		"Message":    message,
+		"Filter":     f,
+		"Books":      books,
+		"HasNext":    hasNext,
+		"NextPage":   f.Page + 1,
+		"PrevPage":   f.Page - 1,
+		"Publishers": publishers,
+		"Sections":   sections,
+	}
+	if err := tmpl.ExecuteTemplate(w, "catalogue.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerCatalogueHandlers() {
+	http.HandleFunc("/catalogue", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		page, _ := strconv.Atoi(q.Get("page"))
+		if page < 0 {
+			page = 0
+		}
+		f := catalogueFilter{
+			Name:           strings.TrimSpace(q.Get("name")),
+			PublisherCode:  q.Get("publisher"),
+			ClassifierCode: q.Get("classifier"),
+			InStockOnly:    q.Get("inStock") != "",
+			Page:           page,
+		}
+		renderCatalogue(ctx, w, f, "")
+	})
+
+	http.HandleFunc("/book", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		bookCode, err := strconv.Atoi(r.URL.Query().Get("code"))
+		if err != nil {
+			renderCatalogue(ctx, w, catalogueFilter{}, "Некорректный код книги.")
+			return
+		}
+		renderBook(ctx, w, bookCode)
+	})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// classifierLink - родительский раздел для раздела классификатора. В таблице Classifier иерархии нет,
+// поэтому она хранится отдельно; разделы без записи находятся на верхнем уровне.
+type classifierLink struct {
+	ClassifierCode string `gorm:"primaryKey;size:50"`
+	ParentCode     string `gorm:"size:50;index"`
+}
+
+func (classifierLink) TableName() string { return "app_classifier_tree" }
+
+func init() {
+	registerModels(&classifierLink{})
+}
+
+// classifierNode - раздел в дереве с числом книг в самом разделе и вместе с подразделами
+type classifierNode struct {
+	Code          string
+	Name          string
+	ParentCode    string
+	Titles        int // наименований в разделе
+	TitlesInStock int // наименований в наличии
+	Copies        int // экземпляров на складе
+	TotalTitles   int
+	TotalInStock  int
+	TotalCopies   int
+	Children      []*classifierNode
+	Open          bool // раздел раскрыт, так как выбран он или его подраздел
+	Selected      bool
+}
+
+// classifierOption - раздел для выпадающего списка с отступом по уровню
+type classifierOption struct {
+	Code  string
+	Label string
+}
+
+// classifierTree - дерево разделов и доступ к разделу по коду
+type classifierTree struct {
+	Roots []*classifierNode
+	nodes map[string]*classifierNode
+}
+
+// loadClassifierTree читает разделы со счетчиками книг и строит дерево
+func loadClassifierTree(ctx context.Context) (*classifierTree, error) {
+	var nodes []*classifierNode
+	err := db().WithContext(ctx).Raw(`
+        SELECT CAST(c.ClassifierCode AS nvarchar(50)) AS Code, c.Name, COALESCE(t.parent_code, '') AS ParentCode,
+               COUNT(b.BookCode) AS Titles,
+               SUM(CASE WHEN w.NumberOfCopies > 0 THEN 1 ELSE 0 END) AS TitlesInStock,
+               COALESCE(SUM(w.NumberOfCopies), 0) AS Copies
+        FROM Classifier c
+        LEFT JOIN app_classifier_tree t ON t.classifier_code = CAST(c.ClassifierCode AS nvarchar(50))
+        LEFT JOIN Books b ON b.ClassifierCode = c.ClassifierCode
+        LEFT JOIN Warehouse w ON w.BookCode = b.BookCode
+        GROUP BY c.ClassifierCode, c.Name, t.parent_code`).Scan(&nodes).Error
+	if err != nil {
+		return nil, err
+	}
+	tree := &classifierTree{nodes: make(map[string]*classifierNode, len(nodes))}
+	for _, n := range nodes {
+		tree.nodes[n.Code] = n
+	}
+	for _, n := range nodes {
+		// Раздел, родитель которого удален, показываем на верхнем уровне
+		if parent, ok := tree.nodes[n.ParentCode]; ok && parent != n {
+			parent.Children = append(parent.Children, n)
+		} else {
+			tree.Roots = append(tree.Roots, n)
+		}
+	}
+	sortClassifierNodes(tree.Roots)
+	for _, n := range tree.Roots {
+		n.sumTotals()
+	}
+	return tree, nil
+}
+
+func sortClassifierNodes(nodes []*classifierNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	for _, n := range nodes {
+		sortClassifierNodes(n.Children)
+	}
+}
+
+// sumTotals суммирует счетчики раздела и всех его подразделов
+func (n *classifierNode) sumTotals() {
+	n.TotalTitles, n.TotalInStock, n.TotalCopies = n.Titles, n.TitlesInStock, n.Copies
+	for _, c := range n.Children {
+		c.sumTotals()
+		n.TotalTitles += c.TotalTitles
+		n.TotalInStock += c.TotalInStock
+		n.TotalCopies += c.TotalCopies
+	}
+}
+
+// subtreeCodes возвращает коды раздела и всех его подразделов
+func (n *classifierNode) subtreeCodes() []string {
+	codes := []string{n.Code}
+	for _, c := range n.Children {
+		codes = append(codes, c.subtreeCodes()...)
+	}
+	return codes
+}
+
+// selectPath отмечает выбранный раздел и раскрывает всех его предков
+func (t *classifierTree) selectPath(code string) []*classifierNode {
+	var path []*classifierNode
+	for n, ok := t.nodes[code]; ok && !n.Open; n, ok = t.nodes[n.ParentCode] {
+		n.Open = true
+		path = append([]*classifierNode{n}, path...)
+	}
+	if len(path) > 0 {
+		path[len(path)-1].Selected = true
+	}
+	return path
+}
+
+// options возвращает разделы в порядке обхода дерева для выпадающих списков
+func (t *classifierTree) options() []classifierOption {
+	var options []classifierOption
+	var walk func(nodes []*classifierNode, depth int)
+	walk = func(nodes []*classifierNode, depth int) {
+		for _, n := range nodes {
+			options = append(options, classifierOption{Code: n.Code, Label: strings.Repeat("— ", depth) + n.Name})
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(t.Roots, 0)
+	return options
+}
+
+// addClassifierSection добавляет раздел в Classifier и, если задан родитель, в дерево
+func addClassifierSection(ctx context.Context, code, name, parentCode string) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO Classifier (ClassifierCode, Name) VALUES (?, ?)", code, name).Error; err != nil {
+			return err
+		}
+		if parentCode != "" {
+			if err := tx.Create(&classifierLink{ClassifierCode: code, ParentCode: parentCode}).Error; err != nil {
+				return err
+			}
+		}
+		return writeAudit(tx, "create", "classifier", code, name)
+	})
+}
+
+// renameClassifierSection меняет название раздела
+func renameClassifierSection(ctx context.Context, code, name string) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec("UPDATE Classifier SET Name = ? WHERE CAST(ClassifierCode AS nvarchar(50)) = ?", name, code)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("раздел не найден")
+		}
+		return writeAudit(tx, "rename", "classifier", code, name)
+	})
+}
+
+// moveClassifierSection переносит раздел под другого родителя; пустой parentCode - на верхний уровень.
+// Перенос в собственный подраздел запрещен, чтобы в дереве не появился цикл.
+func moveClassifierSection(ctx context.Context, tree *classifierTree, code, parentCode string) error {
+	node, ok := tree.nodes[code]
+	if !ok {
+		return errors.New("раздел не найден")
+	}
+	if parentCode != "" {
+		if _, ok := tree.nodes[parentCode]; !ok {
+			return errors.New("родительский раздел не найден")
+		}
+		for _, c := range node.subtreeCodes() {
+			if c == parentCode {
+				return errors.New("нельзя перенести раздел в его собственный подраздел")
+			}
+		}
+	}
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("classifier_code = ?", code).Delete(&classifierLink{}).Error; err != nil {
+			return err
+		}
+		if parentCode != "" {
+			if err := tx.Create(&classifierLink{ClassifierCode: code, ParentCode: parentCode}).Error; err != nil {
+				return err
+			}
+		}
+		return writeAudit(tx, "move", "classifier", code, "родитель: "+parentCode)
+	})
+}
+
+// renderClassifier выводит дерево разделов и книги выбранного раздела вместе с подразделами
+func renderClassifier(ctx context.Context, w http.ResponseWriter, code, message string) {
+	tree, err := loadClassifierTree(ctx)
+	if err != nil {
+		tree = &classifierTree{}
+		message = "Ошибка получения классификатора: " + describeQueryError(ctx, err)
+	}
+	data := map[string]interface{}{
+		"Message": message,
+		"IsAdmin": currentRole == "admin",
+		"Tree":    tree.Roots,
+		"Options": tree.options(),
+	}
+	if path := tree.selectPath(code); len(path) > 0 {
+		selected := path[len(path)-1]
+		data["Path"] = path
+		data["Selected"] = selected
+		var books []bookCard
+		err := db().WithContext(ctx).Raw(bookCardSelect+" WHERE CAST(b.ClassifierCode AS nvarchar(50)) IN ? ORDER BY b.Name",
+			selected.subtreeCodes()).Scan(&books).Error
+		if err != nil {
+			data["Message"] = "Ошибка получения книг раздела: " + describeQueryError(ctx, err)
+		}
+		data["Books"] = books
+	}
+	if err := tmpl.ExecuteTemplate(w, "classifier.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerClassifierHandlers() {
+	http.HandleFunc("/classifier", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderClassifier(ctx, w, r.URL.Query().Get("code"), "")
+	})
+
+	// добавление, переименование и перенос разделов
+	http.HandleFunc("/classifier_update", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderClassifier(ctx, w, "", "Ошибка при обработке формы.")
+			return
+		}
+		code := strings.TrimSpace(r.FormValue("code"))
+		name := strings.TrimSpace(r.FormValue("name"))
+		parentCode := r.FormValue("parent")
+		if code == "" {
+			renderClassifier(ctx, w, "", "Укажите код раздела.")
+			return
+		}
+
+		var err error
+		var message string
+		switch r.FormValue("action") {
+		case "add":
+			if name == "" {
+				renderClassifier(ctx, w, parentCode, "Укажите название раздела.")
+				return
+			}
+			err = addClassifierSection(ctx, code, name, parentCode)
+			message = "✅ Раздел добавлен."
+		case "rename":
+			if name == "" {
+				renderClassifier(ctx, w, code, "Укажите название раздела.")
+				return
+			}
+			err = renameClassifierSection(ctx, code, name)
+			message = "✅ Раздел переименован."
+		case "move":
+			var tree *classifierTree
+			if tree, err = loadClassifierTree(ctx); err == nil {
+				err = moveClassifierSection(ctx, tree, code, parentCode)
+			}
+			message = "✅ Раздел перенесен."
+		default:
+			renderClassifier(ctx, w, code, "Неизвестное действие.")
+			return
+		}
+		if err != nil {
+			renderClassifier(ctx, w, code, "Ошибка изменения классификатора: "+describeQueryError(ctx, err))
+			return
+		}
+		invalidateSearchIndex()
+		renderClassifier(ctx, w, code, message)
+	})
+}
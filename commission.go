@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// commissionRule - процент комиссии с выручки. Правило может относиться к сотруднику, к разделу
+// классификатора, к их сочетанию или, если оба поля пусты, ко всем продажам.
+type commissionRule struct {
+	ID             uint            `gorm:"primaryKey"`
+	EmployeeID     *int            `gorm:"index"`
+	ClassifierCode *string         `gorm:"size:50"`
+	Percent        decimal.Decimal `gorm:"type:decimal(5,2)"`
+}
+
+func (commissionRule) TableName() string { return "app_commission_rules" }
+
+// specificity - чем больше, тем точнее правило: сотрудник и раздел, затем сотрудник, затем раздел
+func (r commissionRule) specificity() int {
+	s := 0
+	if r.EmployeeID != nil {
+		s += 2
+	}
+	if r.ClassifierCode != nil {
+		s++
+	}
+	return s
+}
+
+// matches проверяет, применимо ли правило к продажам сотрудника в разделе
+func (r commissionRule) matches(employeeID int, classifierCode string) bool {
+	return (r.EmployeeID == nil || *r.EmployeeID == employeeID) &&
+		(r.ClassifierCode == nil || *r.ClassifierCode == classifierCode)
+}
+
+// commissionStatement - расчетный лист сотрудника за месяц; сохраняется при утверждении
+type commissionStatement struct {
+	ID           uint   `gorm:"primaryKey"`
+	Month        string `gorm:"size:7;uniqueIndex:idx_commission_statement"`
+	EmployeeID   int    `gorm:"uniqueIndex:idx_commission_statement"`
+	EmployeeName string `gorm:"size:200"`
+	Units        int
+	Revenue      decimal.Decimal `gorm:"type:decimal(18,2)"`
+	Commission   decimal.Decimal `gorm:"type:decimal(18,2)"`
+	FinalizedAt  *time.Time
+	FinalizedBy  string                    `gorm:"size:100"`
+	Lines        []commissionStatementLine `gorm:"foreignKey:StatementID"`
+}
+
+func (commissionStatement) TableName() string { return "app_commission_statements" }
+
+// Finalized - лист утвержден и больше не пересчитывается
+func (s commissionStatement) Finalized() bool { return s.FinalizedAt != nil }
+
+// commissionStatementLine - строка расчетного листа по разделу классификатора
+type commissionStatementLine struct {
+	ID             uint `gorm:"primaryKey"`
+	StatementID    uint
+	ClassifierCode string `gorm:"size:50"`
+	ClassifierName string `gorm:"size:200"`
+	Units          int
+	Revenue        decimal.Decimal `gorm:"type:decimal(18,2)"`
+	Percent        decimal.Decimal `gorm:"type:decimal(5,2)"`
+	Amount         decimal.Decimal `gorm:"type:decimal(18,2)"`
+}
+
+func (commissionStatementLine) TableName() string { return "app_commission_statement_lines" }
+
+func init() {
+	registerModels(&commissionRule{}, &commissionStatement{}, &commissionStatementLine{})
+}
+
+// monthRange возвращает период календарного месяца в формате ГГГГ-ММ
+func monthRange(month string) (dateRange, error) {
+	from, err := time.Parse("2006-01", month)
+	if err != nil {
+		return dateRange{}, fmt.Errorf("ожидается месяц в формате ГГГГ-ММ")
+	}
+	return dateRange{From: from, To: from.AddDate(0, 1, -1)}, nil
+}
+
+// ruleFor выбирает самое точное правило для продаж сотрудника в разделе; без правила комиссия нулевая
+func ruleFor(rules []commissionRule, employeeID int, classifierCode string) decimal.Decimal {
+	best := -1
+	percent := decimal.Zero
+	for _, r := range rules {
+		if r.matches(employeeID, classifierCode) && r.specificity() > best {
+			best = r.specificity()
+			percent = r.Percent
+		}
+	}
+	return percent
+}
+
+// calculateCommissions рассчитывает листы всех сотрудников за месяц по продажам из Sales
+func calculateCommissions(tx *gorm.DB, month string) ([]commissionStatement, error) {
+	period, err := monthRange(month)
+	if err != nil {
+		return nil, err
+	}
+	var rules []commissionRule
+	if err := tx.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		EmployeeID     int
+		EmployeeName   string
+		ClassifierCode string
+		ClassifierName string
+		Units          int
+		Revenue        decimal.Decimal
+	}
+	err = tx.Raw(`
+        SELECT s.EmployeeID, COALESCE(e.FullName, '') AS EmployeeName,
+               COALESCE(CAST(b.ClassifierCode AS nvarchar(50)), '') AS ClassifierCode, COALESCE(c.Name, '') AS ClassifierName,
+               SUM(s.Quantity) AS Units, SUM(`+salesRevenueExpr+`) AS Revenue
+        FROM Sales s
+        LEFT JOIN Employees e ON e.EmployeeID = s.EmployeeID
+        LEFT JOIN Books b ON b.BookCode = s.BookID
+        LEFT JOIN Classifier c ON c.ClassifierCode = b.ClassifierCode
+        `+salesPriceJoin+`
+        WHERE s.SaleDate >= ? AND s.SaleDate < ?
+        GROUP BY s.EmployeeID, e.FullName, b.ClassifierCode, c.Name
+        ORDER BY e.FullName, s.EmployeeID, c.Name`, period.From, period.end()).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []commissionStatement
+	hundred := decimal.NewFromInt(100)
+	for _, row := range rows {
+		if len(statements) == 0 || statements[len(statements)-1].EmployeeID != row.EmployeeID {
+			statements = append(statements, commissionStatement{Month: month, EmployeeID: row.EmployeeID, EmployeeName: row.EmployeeName})
+		}
+		st := &statements[len(statements)-1]
+		percent := ruleFor(rules, row.EmployeeID, row.ClassifierCode)
+		line := commissionStatementLine{
+			ClassifierCode: row.ClassifierCode,
+			ClassifierName: row.ClassifierName,
+			Units:          row.Units,
+			Revenue:        row.Revenue,
+			Percent:        percent,
+			Amount:         row.Revenue.Mul(percent).Div(hundred).Round(2),
+		}
+		st.Lines = append(st.Lines, line)
+		st.Units += line.Units
+		st.Revenue = st.Revenue.Add(line.Revenue)
+		st.Commission = st.Commission.Add(line.Amount)
+	}
+	return statements, nil
+}
+
+// monthStatements возвращает листы за месяц: утвержденные - из базы, остальные - пересчитанные черновики
+func monthStatements(ctx context.Context, month string) ([]commissionStatement, error) {
+	tx := db().WithContext(ctx)
+	var finalized []commissionStatement
+	if err := tx.Preload("Lines").Where("month = ?", month).Find(&finalized).Error; err != nil {
+		return nil, err
+	}
+	drafts, err := calculateCommissions(tx, month)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool, len(finalized))
+	for _, st := range finalized {
+		done[st.EmployeeID] = true
+	}
+	statements := finalized
+	for _, st := range drafts {
+		if !done[st.EmployeeID] {
+			statements = append(statements, st)
+		}
+	}
+	sort.Slice(statements, func(i, j int) bool { return statements[i].EmployeeName < statements[j].EmployeeName })
+	return statements, nil
+}
+
+// finalizeStatement пересчитывает лист сотрудника и сохраняет его как утвержденный
+func finalizeStatement(ctx context.Context, month string, employeeID int) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&commissionStatement{}).Where("month = ? AND employee_id = ?", month, employeeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("лист за этот месяц уже утвержден")
+		}
+		statements, err := calculateCommissions(tx, month)
+		if err != nil {
+			return err
+		}
+		for _, st := range statements {
+			if st.EmployeeID != employeeID {
+				continue
+			}
+			now := time.Now()
+			st.FinalizedAt = &now
+			st.FinalizedBy = currentUser
+			if err := tx.Create(&st).Error; err != nil {
+				return err
+			}
+			details := fmt.Sprintf("%s: комиссия %s с выручки %s", month, st.Commission.StringFixed(2), st.Revenue.StringFixed(2))
+			return writeAudit(tx, "finalize", "commission", strconv.Itoa(employeeID), details)
+		}
+		return errors.New("у сотрудника нет продаж за месяц")
+	})
+}
+
+// statementResultSet представляет лист как набор строк для выгрузки
+func statementResultSet(st commissionStatement) *resultSet {
+	rs := &resultSet{
+		Title:      fmt.Sprintf("%s, %s: комиссия %s", st.EmployeeName, st.Month, st.Commission.StringFixed(2)),
+		Columns:    []string{"Код раздела", "Раздел", "Экземпляров", "Выручка", "Процент", "Комиссия"},
+		BookColumn: -1,
+	}
+	for _, l := range st.Lines {
+		rs.Rows = append(rs.Rows, []interface{}{l.ClassifierCode, l.ClassifierName, l.Units,
+			l.Revenue.StringFixed(2), l.Percent.StringFixed(2), l.Amount.StringFixed(2)})
+	}
+	rs.Rows = append(rs.Rows, []interface{}{"", "Итого", st.Units, st.Revenue.StringFixed(2), "", st.Commission.StringFixed(2)})
+	return rs
+}
+
+// ruleView - правило с названиями сотрудника и раздела
+type ruleView struct {
+	ID           uint
+	EmployeeName string
+	SectionName  string
+	Percent      decimal.Decimal
+}
+
+// listCommissionRules возвращает правила в порядке от общих к частным
+func listCommissionRules(ctx context.Context) ([]ruleView, error) {
+	var rules []ruleView
+	err := db().WithContext(ctx).Raw(`
+        SELECT r.id AS ID,
+               COALESCE(e.FullName, CAST(r.employee_id AS nvarchar(20)), '') AS EmployeeName,
+               COALESCE(c.Name, r.classifier_code, '') AS SectionName,
+               r.percent AS Percent
+        FROM app_commission_rules r
+        LEFT JOIN Employees e ON e.EmployeeID = r.employee_id
+        LEFT JOIN Classifier c ON CAST(c.ClassifierCode AS nvarchar(50)) = r.classifier_code
+        ORDER BY CASE WHEN r.employee_id IS NULL THEN 0 ELSE 1 END, EmployeeName, SectionName`).Scan(&rules).Error
+	return rules, err
+}
+
+// renderCommissions выводит правила и расчетные листы за месяц
+func renderCommissions(ctx context.Context, w http.ResponseWriter, month, message string) {
+	data := map[string]interface{}{"Month": month}
+	if currentRole != "admin" {
+		data["Message"] = "Расчет комиссий доступен только администратору."
+		if err := tmpl.ExecuteTemplate(w, "commission.html", data); err != nil {
+			http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	messages := []string{message}
+	statements, err := monthStatements(ctx, month)
+	if err != nil {
+		messages = append(messages, "Ошибка расчета комиссий: "+describeQueryError(ctx, err))
+	}
+	rules, err := listCommissionRules(ctx)
+	if err != nil {
+		messages = append(messages, "Ошибка получения правил: "+describeQueryError(ctx, err))
+	}
+	data["Message"] = strings.TrimSpace(strings.Join(messages, " "))
+	data["Statements"] = statements
+	data["Rules"] = rules
+	if err := tmpl.ExecuteTemplate(w, "commission.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderStatement выводит расчетный лист сотрудника
+func renderStatement(ctx context.Context, w http.ResponseWriter, month string, employeeID int, message string) {
+	statements, err := monthStatements(ctx, month)
+	if err != nil {
+		renderCommissions(ctx, w, month, "Ошибка расчета комиссий: "+describeQueryError(ctx, err))
+		return
+	}
+	for _, st := range statements {
+		if st.EmployeeID == employeeID {
+			data := map[string]interface{}{"Message": message, "Statement": st}
+			if err := tmpl.ExecuteTemplate(w, "commission_statement.html", data); err != nil {
+				http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	renderCommissions(ctx, w, month, "У сотрудника нет продаж за месяц.")
+}
+
+// commissionMonth читает месяц из формы; по умолчанию - предыдущий месяц, за который обычно идет расчет
+func commissionMonth(form url.Values) string {
+	if month := form.Get("month"); month != "" {
+		return month
+	}
+	return time.Now().AddDate(0, -1, 0).Format("2006-01")
+}
+
+func registerCommissionHandlers() {
+	http.HandleFunc("/commission", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		month := commissionMonth(r.URL.Query())
+		if _, err := monthRange(month); err != nil {
+			renderCommissions(ctx, w, commissionMonth(nil), "Ошибка в месяце: "+err.Error())
+			return
+		}
+		renderCommissions(ctx, w, month, "")
+	})
+
+	http.HandleFunc("/commission_statement", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		month := commissionMonth(q)
+		employeeID, err := strconv.Atoi(q.Get("employee"))
+		if _, monthErr := monthRange(month); err != nil || monthErr != nil || currentRole != "admin" {
+			renderCommissions(ctx, w, commissionMonth(nil), "Некорректный сотрудник или месяц.")
+			return
+		}
+		renderStatement(ctx, w, month, employeeID, "")
+	})
+
+	http.HandleFunc("/commission_finalize", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderCommissions(ctx, w, commissionMonth(nil), "Ошибка при обработке формы.")
+			return
+		}
+		month := commissionMonth(r.Form)
+		employeeID, err := strconv.Atoi(r.FormValue("employee"))
+		if err != nil {
+			renderCommissions(ctx, w, month, "Некорректный сотрудник.")
+			return
+		}
+		if err := finalizeStatement(ctx, month, employeeID); err != nil {
+			renderStatement(ctx, w, month, employeeID, "Ошибка утверждения листа: "+describeQueryError(ctx, err))
+			return
+		}
+		renderStatement(ctx, w, month, employeeID, "✅ Лист утвержден и сохранен.")
+	})
+
+	// выгрузка утвержденных листов за месяц; employee ограничивает выгрузку одним сотрудником
+	http.HandleFunc("/commission_export", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		month := commissionMonth(q)
+		if currentRole != "admin" {
+			renderCommissions(ctx, w, month, "")
+			return
+		}
+		query := db().WithContext(ctx).Preload("Lines").Where("month = ?", month)
+		if employeeID, err := strconv.Atoi(q.Get("employee")); err == nil {
+			query = query.Where("employee_id = ?", employeeID)
+		}
+		var statements []commissionStatement
+		if err := query.Order("employee_name").Find(&statements).Error; err != nil {
+			renderCommissions(ctx, w, month, "Ошибка получения листов: "+describeQueryError(ctx, err))
+			return
+		}
+		if len(statements) == 0 {
+			renderCommissions(ctx, w, month, "Утвержденных листов за месяц нет.")
+			return
+		}
+		var sets []*resultSet
+		for _, st := range statements {
+			sets = append(sets, statementResultSet(st))
+		}
+		setDownloadHeaders(w, "commission_"+month+".csv", "text/csv; charset=utf-8")
+		writeCSV(w, sets)
+	})
+
+	http.HandleFunc("/commission_rule", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderCommissions(ctx, w, commissionMonth(nil), "Ошибка при обработке формы.")
+			return
+		}
+		month := commissionMonth(r.Form)
+		percent, err := decimal.NewFromString(strings.TrimSpace(r.FormValue("percent")))
+		if err != nil || percent.IsNegative() || percent.GreaterThan(decimal.NewFromInt(100)) {
+			renderCommissions(ctx, w, month, "Процент должен быть числом от 0 до 100.")
+			return
+		}
+		rule := commissionRule{Percent: percent}
+		if v := strings.TrimSpace(r.FormValue("employeeId")); v != "" {
+			employeeID, err := strconv.Atoi(v)
+			if err != nil {
+				renderCommissions(ctx, w, month, "Код сотрудника должен быть числом.")
+				return
+			}
+			rule.EmployeeID = &employeeID
+		}
+		if v := strings.TrimSpace(r.FormValue("classifierCode")); v != "" {
+			rule.ClassifierCode = &v
+		}
+		if err := db().WithContext(ctx).Create(&rule).Error; err != nil {
+			renderCommissions(ctx, w, month, "Ошибка сохранения правила: "+describeQueryError(ctx, err))
+			return
+		}
+		renderCommissions(ctx, w, month, "✅ Правило добавлено.")
+	})
+
+	http.HandleFunc("/commission_rule_delete", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderCommissions(ctx, w, commissionMonth(nil), "Ошибка при обработке формы.")
+			return
+		}
+		month := commissionMonth(r.Form)
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			renderCommissions(ctx, w, month, "Некорректное правило.")
+			return
+		}
+		if err := db().WithContext(ctx).Delete(&commissionRule{}, id).Error; err != nil {
+			renderCommissions(ctx, w, month, "Ошибка удаления правила: "+describeQueryError(ctx, err))
+			return
+		}
+		renderCommissions(ctx, w, month, "✅ Правило удалено.")
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRuleFor(t *testing.T) {
+	emp := func(id int) *int { return &id }
+	sec := func(code string) *string { return &code }
+	pct := decimal.RequireFromString
+	rules := []commissionRule{
+		{Percent: pct("1")},
+		{ClassifierCode: sec("01"), Percent: pct("2")},
+		{EmployeeID: emp(7), Percent: pct("3")},
+		{EmployeeID: emp(7), ClassifierCode: sec("01"), Percent: pct("4.5")},
+		{EmployeeID: emp(8), ClassifierCode: sec("02"), Percent: pct("5")},
+	}
+	tests := []struct {
+		name       string
+		rules      []commissionRule
+		employeeID int
+		section    string
+		want       string
+	}{
+		{"без правил", nil, 7, "01", "0"},
+		{"только общее правило", rules, 9, "03", "1"},
+		{"раздел точнее общего", rules, 9, "01", "2"},
+		{"сотрудник точнее раздела", rules, 7, "02", "3"},
+		{"сотрудник и раздел точнее всего", rules, 7, "01", "4.5"},
+		{"правило другого сотрудника не применяется", rules, 8, "01", "2"},
+		{"сочетание применяется только к своему разделу", rules, 8, "03", "1"},
+		{"нет подходящего правила", rules[3:], 9, "01", "0"},
+	}
+	for _, tt := range tests {
+		if got := ruleFor(tt.rules, tt.employeeID, tt.section); !got.Equal(pct(tt.want)) {
+			t.Errorf("%s: ruleFor(%d, %q) = %s, want %s", tt.name, tt.employeeID, tt.section, got, tt.want)
+		}
+	}
+}
+
+func TestRuleForFirstOfEqualSpecificity(t *testing.T) {
+	section := "01"
+	rules := []commissionRule{
+		{ClassifierCode: &section, Percent: decimal.NewFromInt(2)},
+		{ClassifierCode: &section, Percent: decimal.NewFromInt(6)},
+	}
+	if got := ruleFor(rules, 1, "01"); !got.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("при равной точности ожидается первое правило, получено %s", got)
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	tests := []struct {
+		month    string
+		from, to string
+		wantErr  bool
+	}{
+		{"2024-02", "2024-02-01", "2024-02-29", false},
+		{"2023-02", "2023-02-01", "2023-02-28", false},
+		{"2024-12", "2024-12-01", "2024-12-31", false},
+		{"2024-13", "", "", true},
+		{"2024-1", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := monthRange(tt.month)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("monthRange(%q) error = %v, wantErr %v", tt.month, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got.From.Format("2006-01-02") != tt.from || got.To.Format("2006-01-02") != tt.to) {
+			t.Errorf("monthRange(%q) = %s..%s, want %s..%s", tt.month, got.From.Format("2006-01-02"), got.To.Format("2006-01-02"), tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// appConfig - настройки приложения из config.json
+type appConfig struct {
+	ProcedureSchemas []string          `json:"procedureSchemas"` // схемы, процедуры которых доступны для вызова
+	ProcedureTitles  map[string]string `json:"procedureTitles"`  // описания процедур по имени schema.name
+
+	ProcedureResultTitles map[string][]string `json:"procedureResultTitles"` // заголовки наборов результатов процедур
+
+	StatementTimeouts map[string]string `json:"statementTimeouts"` // таймауты запросов по endpoint, ключ "default" - для остальных
+	statementTimeouts map[string]time.Duration
+
+	Stock  stockConfig  `json:"stock"`
+	Search searchConfig `json:"search"`
+
+	Valuation valuationConfig `json:"valuation"`
+	Scheduler schedulerConfig `json:"scheduler"`
+	Jobs      jobsConfig      `json:"jobs"`
+	Console   consoleConfig   `json:"console"`
+}
+
+// stockConfig - параметры контроля остатков на складе
+type stockConfig struct {
+	DefaultMinCopies int `json:"defaultMinCopies"` // порог, если для книги и раздела он не задан
+	VelocityDays     int `json:"velocityDays"`     // за сколько дней считать скорость продаж
+	CoverDays        int `json:"coverDays"`        // на сколько дней продаж рассчитан дозаказ
+}
+
+// searchConfig - параметры поиска книг
+type searchConfig struct {
+	UseIndex     bool   `json:"useIndex"`     // искать по индексу в памяти вместо запросов LIKE к базе
+	IndexRefresh string `json:"indexRefresh"` // через сколько перестраивать индекс, например "10m"
+	Limit        int    `json:"limit"`        // максимальное число результатов
+	indexRefresh time.Duration
+}
+
+// valuationConfig - параметры ежедневных снимков склада
+type valuationConfig struct {
+	SnapshotTime string `json:"snapshotTime"` // время ежедневного снимка, например "23:30"
+	snapshotTime time.Duration
+}
+
+// schedulerConfig - доставка отчетов по расписанию
+type schedulerConfig struct {
+	Outbox  string     `json:"outbox"`  // каталог, куда складываются файлы отчетов
+	PDFFont string     `json:"pdfFont"` // шрифт TrueType с кириллицей для отчетов в PDF
+	SMTP    smtpConfig `json:"smtp"`
+}
+
+// smtpConfig - почтовый сервер-ретранслятор
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	From     string `json:"from"`
+	Username string `json:"username"` // пусто, если ретранслятор не требует авторизации
+	Password string `json:"password"`
+}
+
+// jobsConfig - фоновое выполнение процедур, запросов и выгрузок
+type jobsConfig struct {
+	Workers   int    `json:"workers"`   // сколько заданий выполняется одновременно
+	ResultDir string `json:"resultDir"` // каталог для файлов с результатами
+	Retention string `json:"retention"` // сколько хранить результаты, например "24h"
+	retention time.Duration
+}
+
+// consoleConfig - ограничения SQL-консоли администратора; время выполнения задается
+// таймаутом "/sql_console_run" в statementTimeouts
+type consoleConfig struct {
+	MaxRows int `json:"maxRows"` // сколько строк каждого набора показывать
+}
+
+var config = appConfig{
+	ProcedureSchemas: []string{"dbo"},
+	Stock:            stockConfig{DefaultMinCopies: 3, VelocityDays: 30, CoverDays: 30},
+	Search:           searchConfig{Limit: 50, IndexRefresh: "10m", indexRefresh: 10 * time.Minute},
+	Valuation:        valuationConfig{SnapshotTime: "23:30", snapshotTime: 23*time.Hour + 30*time.Minute},
+	Scheduler:        schedulerConfig{Outbox: "outbox", SMTP: smtpConfig{Port: 25}},
+	Jobs:             jobsConfig{Workers: 2, ResultDir: "jobs", Retention: "24h", retention: 24 * time.Hour},
+	Console:          consoleConfig{MaxRows: 1000},
+}
+
+func init() {
+	data, err := os.ReadFile("config.json")
+	if os.IsNotExist(err) {
+		return // Используем настройки по умолчанию
+	}
+	if err != nil {
+		panic("Ошибка чтения config.json: " + err.Error())
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		panic("Ошибка разбора config.json: " + err.Error())
+	}
+	config.statementTimeouts, err = parseTimeouts(config.StatementTimeouts)
+	if err != nil {
+		panic("Ошибка разбора config.json: " + err.Error())
+	}
+	if config.Search.IndexRefresh != "" {
+		config.Search.indexRefresh, err = time.ParseDuration(config.Search.IndexRefresh)
+		if err != nil {
+			panic("Ошибка разбора config.json: search.indexRefresh: " + err.Error())
+		}
+	}
+	if config.Valuation.SnapshotTime != "" {
+		at, err := time.Parse("15:04", config.Valuation.SnapshotTime)
+		if err != nil {
+			panic("Ошибка разбора config.json: valuation.snapshotTime: " + err.Error())
+		}
+		config.Valuation.snapshotTime = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	}
+	config.Jobs.retention, err = time.ParseDuration(config.Jobs.Retention)
+	if err != nil || config.Jobs.retention <= 0 {
+		panic("Ошибка разбора config.json: jobs.retention: " + config.Jobs.Retention)
+	}
+	if config.Jobs.Workers < 1 {
+		panic("Ошибка разбора config.json: jobs.workers должно быть не меньше 1")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"a * * * *",
+		"5-1 * * * *",
+		"1-a * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): ожидалась ошибка", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr  string
+		after string
+		want  string // пусто - запуска нет
+	}{
+		{"0 8 * * 1", "2024-01-01 07:59", "2024-01-01 08:00"},
+		{"0 8 * * 1", "2024-01-01 08:00", "2024-01-08 08:00"},
+		{"*/15 * * * *", "2024-01-01 10:07", "2024-01-01 10:15"},
+		{"*/15 * * * *", "2024-01-01 23:50", "2024-01-02 00:00"},
+		{"5/20 * * * *", "2024-01-01 10:30", "2024-01-01 10:45"},
+		{"0 9-17/4 * * *", "2024-01-01 13:00", "2024-01-01 17:00"},
+		{"0 0 1 * *", "2024-01-15 12:00", "2024-02-01 00:00"},
+		{"0 0 1 1,7 *", "2024-02-01 00:00", "2024-07-01 00:00"},
+		{"30 23 * * 0", "2024-01-01 00:00", "2024-01-07 23:30"},
+		{"30 23 * * 7", "2024-01-01 00:00", "2024-01-07 23:30"},
+		// заданы и день месяца, и день недели - достаточно любого
+		{"0 9 13 * 5", "2024-01-10 12:00", "2024-01-12 09:00"},
+		{"0 9 13 * 5", "2024-01-12 10:00", "2024-01-13 09:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 31 2 *", "2024-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		got := c.Next(at(tt.after))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q после %s: получено %s, запуска быть не должно", tt.expr, tt.after, got.Format("2006-01-02 15:04"))
+			}
+			continue
+		}
+		if want := at(tt.want); !got.Equal(want) {
+			t.Errorf("%q после %s: получено %s, ожидалось %s", tt.expr, tt.after, got.Format("2006-01-02 15:04"), tt.want)
+		}
+		if !got.IsZero() && !c.Matches(got) {
+			t.Errorf("%q: Next вернул %s, но Matches для него ложно", tt.expr, got.Format("2006-01-02 15:04"))
+		}
+	}
+}
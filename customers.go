@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// customer - заказчик в реестре. В Orders заказчик хранится только строкой CustomerInfo,
+// поэтому карточки и привязка заказов к ним хранятся отдельно.
+type customer struct {
+	ID        uint   `gorm:"primaryKey"`
+	Surname   string `gorm:"size:100;index"`
+	Name      string `gorm:"size:100"`
+	Phone     string `gorm:"size:20;index"` // только цифры с кодом страны, например +79161234567
+	Email     string `gorm:"size:200;index"`
+	CreatedAt time.Time
+}
+
+func (customer) TableName() string { return "app_customers" }
+
+// FullName - фамилия и имя заказчика
+func (c customer) FullName() string {
+	return strings.TrimSpace(c.Surname + " " + c.Name)
+}
+
+// CustomerInfo - строка заказчика для Orders в прежнем формате «Фамилия Имя, телефон»
+func (c customer) CustomerInfo() string {
+	parts := []string{c.FullName()}
+	if c.Phone != "" {
+		parts = append(parts, c.Phone)
+	}
+	if c.Email != "" {
+		parts = append(parts, c.Email)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// customerOrder - привязка заказа из Orders к заказчику
+type customerOrder struct {
+	OrderID    int  `gorm:"primaryKey;autoIncrement:false"`
+	CustomerID uint `gorm:"index"`
+}
+
+func (customerOrder) TableName() string { return "app_customer_orders" }
+
+func init() {
+	registerModels(&customer{}, &customerOrder{})
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[^\s,;<>()]+@[^\s,;<>()]+\.[^\s,;<>()]+`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s\-()]{5,}\d`)
+)
+
+// Служебные слова, которые встречаются в CustomerInfo рядом с контактами
+var customerInfoNoise = map[string]bool{
+	"тел": true, "телефон": true, "моб": true, "email": true, "e-mail": true, "почта": true,
+}
+
+// normalizePhone оставляет в номере только цифры; российские номера приводятся к виду +7XXXXXXXXXX
+func normalizePhone(s string) string {
+	var digits strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	d := digits.String()
+	switch {
+	case len(d) == 11 && (d[0] == '8' || d[0] == '7'):
+		return "+7" + d[1:]
+	case len(d) == 10 && d[0] == '9':
+		return "+7" + d
+	case d == "":
+		return ""
+	}
+	return "+" + d
+}
+
+// capitalizeWord приводит слово к виду «Иванов», в том числе части двойной фамилии
+func capitalizeWord(w string) string {
+	parts := strings.Split(strings.ToLower(w), "-")
+	for i, p := range parts {
+		runes := []rune(p)
+		if len(runes) > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		parts[i] = string(runes)
+	}
+	return strings.Join(parts, "-")
+}
+
+// parseCustomerInfo разбирает строку заказчика: e-mail и телефон ищутся по шаблону,
+// из оставшихся слов первое - фамилия, остальные - имя (и отчество, если указано)
+func parseCustomerInfo(info string) customer {
+	var c customer
+	rest := info
+	if email := emailPattern.FindString(rest); email != "" {
+		c.Email = strings.ToLower(email)
+		rest = strings.Replace(rest, email, " ", 1)
+	}
+	for _, candidate := range phonePattern.FindAllString(rest, -1) {
+		if phone := normalizePhone(candidate); validPhone(phone) {
+			c.Phone = phone
+			rest = strings.Replace(rest, candidate, " ", 1)
+			break
+		}
+	}
+	var words []string
+	for _, w := range strings.FieldsFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) && r != '-' }) {
+		w = strings.Trim(w, "-")
+		if w != "" && !customerInfoNoise[strings.ToLower(w)] {
+			words = append(words, capitalizeWord(w))
+		}
+	}
+	if len(words) > 0 {
+		c.Surname = words[0]
+		c.Name = strings.Join(words[1:], " ")
+	}
+	return c
+}
+
+// customerNameKey - фамилия и первое слово имени для сравнения; пусто, если чего-то нет
+func customerNameKey(c customer) string {
+	names := strings.Fields(c.Name)
+	if c.Surname == "" || len(names) == 0 {
+		return ""
+	}
+	return normalizeSearchText(c.Surname) + " " + normalizeSearchText(names[0])
+}
+
+// customerMatch - карточка, похожая на проверяемого заказчика
+type customerMatch struct {
+	Customer customer
+	Reasons  []string
+}
+
+// findCustomerMatches ищет среди карточек совпадения по телефону, e-mail или фамилии с именем
+func findCustomerMatches(customers []customer, c customer) []customerMatch {
+	var matches []customerMatch
+	nameKey := customerNameKey(c)
+	for _, existing := range customers {
+		if existing.ID == c.ID {
+			continue
+		}
+		var reasons []string
+		if c.Phone != "" && existing.Phone == c.Phone {
+			reasons = append(reasons, "телефон")
+		}
+		if c.Email != "" && strings.EqualFold(existing.Email, c.Email) {
+			reasons = append(reasons, "e-mail")
+		}
+		if nameKey != "" && customerNameKey(existing) == nameKey {
+			reasons = append(reasons, "ФИО")
+		}
+		if len(reasons) > 0 {
+			matches = append(matches, customerMatch{Customer: existing, Reasons: reasons})
+		}
+	}
+	return matches
+}
+
+// validPhone проверяет нормализованный номер: от 7 до 15 цифр, как допускает международный формат
+func validPhone(phone string) bool {
+	digits := len(strings.TrimPrefix(phone, "+"))
+	return digits >= 7 && digits <= 15
+}
+
+// validateCustomer проверяет поля карточки и отклоняет дубликаты по телефону и e-mail.
+// Совпадение только по фамилии и имени допускается: это могут быть разные люди.
+func validateCustomer(tx *gorm.DB, c *customer) error {
+	c.Surname = strings.TrimSpace(c.Surname)
+	c.Name = strings.TrimSpace(c.Name)
+	c.Email = strings.ToLower(strings.TrimSpace(c.Email))
+	c.Phone = strings.TrimSpace(c.Phone)
+	if c.Phone != "" {
+		c.Phone = normalizePhone(c.Phone)
+		if !validPhone(c.Phone) {
+			return errors.New("телефон должен содержать от 7 до 15 цифр")
+		}
+	}
+	if c.Surname == "" {
+		return errors.New("укажите фамилию заказчика")
+	}
+	if c.Email != "" && !emailPattern.MatchString(c.Email) {
+		return errors.New("некорректный e-mail")
+	}
+	if c.Phone == "" && c.Email == "" {
+		return nil
+	}
+	// Пустое поле не сравнивается: иначе совпадут все карточки без телефона или e-mail
+	var conditions []string
+	var args []interface{}
+	if c.Phone != "" {
+		conditions = append(conditions, "phone = ?")
+		args = append(args, c.Phone)
+	}
+	if c.Email != "" {
+		conditions = append(conditions, "email = ?")
+		args = append(args, c.Email)
+	}
+	var duplicate customer
+	err := tx.Where("id <> ?", c.ID).Where(strings.Join(conditions, " OR "), args...).Limit(1).Find(&duplicate).Error
+	if err != nil {
+		return err
+	}
+	if duplicate.ID != 0 {
+		return fmt.Errorf("такой телефон или e-mail уже у заказчика «%s» (№%d)", duplicate.FullName(), duplicate.ID)
+	}
+	return nil
+}
+
+// saveCustomer создает или изменяет карточку заказчика
+func saveCustomer(ctx context.Context, c *customer) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := validateCustomer(tx, c); err != nil {
+			return err
+		}
+		action := "update"
+		if c.ID == 0 {
+			action = "create"
+		}
+		if err := tx.Save(c).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, action, "customer", strconv.Itoa(int(c.ID)), c.CustomerInfo())
+	})
+}
+
+// linkOrdersByInfo привязывает к заказчику все непривязанные заказы с такой строкой CustomerInfo
+func linkOrdersByInfo(tx *gorm.DB, info string, customerID uint) (int64, error) {
+	res := tx.Exec(`
+        INSERT INTO app_customer_orders (order_id, customer_id)
+        SELECT o.OrderID, ?
+        FROM Orders o
+        WHERE COALESCE(o.CustomerInfo, '') = ?
+          AND NOT EXISTS (SELECT 1 FROM app_customer_orders c WHERE c.order_id = o.OrderID)`, customerID, info)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if err := writeAudit(tx, "link_orders", "customer", strconv.Itoa(int(customerID)), fmt.Sprintf("%s: заказов %d", info, res.RowsAffected)); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected, nil
+}
+
+// pendingCustomerInfo - строка CustomerInfo, заказы с которой еще не привязаны к карточке
+type pendingCustomerInfo struct {
+	CustomerInfo string
+	Orders       int
+	FirstOrder   time.Time
+	LastOrder    time.Time
+	Parsed       customer        `gorm:"-"`
+	Matches      []customerMatch `gorm:"-"` // похожие карточки
+	Similar      []string        `gorm:"-"` // похожие строки среди непривязанных
+}
+
+// loadPendingCustomerInfos разбирает непривязанные строки CustomerInfo и подбирает совпадения
+func loadPendingCustomerInfos(ctx context.Context) ([]pendingCustomerInfo, error) {
+	var pending []pendingCustomerInfo
+	err := db().WithContext(ctx).Raw(`
+        SELECT COALESCE(o.CustomerInfo, '') AS CustomerInfo, COUNT(*) AS Orders,
+               MIN(o.OrderDate) AS FirstOrder, MAX(o.OrderDate) AS LastOrder
+        FROM Orders o
+        LEFT JOIN app_customer_orders c ON c.order_id = o.OrderID
+        WHERE c.order_id IS NULL
+        GROUP BY COALESCE(o.CustomerInfo, '')
+        ORDER BY CustomerInfo`).Scan(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	var customers []customer
+	if err := db().WithContext(ctx).Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	// Непривязанные строки сравниваются и между собой, чтобы не завести две карточки на одного человека
+	parsed := make([]customer, len(pending))
+	for i := range pending {
+		pending[i].Parsed = parseCustomerInfo(pending[i].CustomerInfo)
+		pending[i].Matches = findCustomerMatches(customers, pending[i].Parsed)
+		parsed[i] = pending[i].Parsed
+		parsed[i].ID = uint(i + 1)
+	}
+	for i := range pending {
+		self := parsed[i]
+		for _, m := range findCustomerMatches(parsed, self) {
+			pending[m.Customer.ID-1].Similar = append(pending[m.Customer.ID-1].Similar, pending[i].CustomerInfo)
+		}
+	}
+	return pending, nil
+}
+
+// createCustomersWithoutMatches заводит карточки для строк без похожих карточек и строк
+func createCustomersWithoutMatches(ctx context.Context) (int, error) {
+	pending, err := loadPendingCustomerInfos(ctx)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	err = db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, p := range pending {
+			if len(p.Matches) > 0 || len(p.Similar) > 0 || p.Parsed.Surname == "" {
+				continue
+			}
+			c := p.Parsed
+			if err := tx.Create(&c).Error; err != nil {
+				return err
+			}
+			if err := writeAudit(tx, "create", "customer", strconv.Itoa(int(c.ID)), c.CustomerInfo()); err != nil {
+				return err
+			}
+			if _, err := linkOrdersByInfo(tx, p.CustomerInfo, c.ID); err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	return created, err
+}
+
+// customerSummary - заказчик с числом заказов для списка
+type customerSummary struct {
+	customer
+	Orders    int
+	LastOrder *time.Time
+}
+
+// listCustomers ищет заказчиков по началу фамилии, телефону или e-mail
+func listCustomers(ctx context.Context, query string) ([]customerSummary, error) {
+	sql := `
+        SELECT c.id, c.surname, c.name, c.phone, c.email, c.created_at,
+               COUNT(co.order_id) AS Orders, MAX(o.OrderDate) AS LastOrder
+        FROM app_customers c
+        LEFT JOIN app_customer_orders co ON co.customer_id = c.id
+        LEFT JOIN Orders o ON o.OrderID = co.order_id`
+	var args []interface{}
+	if query = strings.TrimSpace(query); query != "" {
+		sql += " WHERE c.surname LIKE ? ESCAPE '\\' OR c.email LIKE ? ESCAPE '\\'"
+		args = append(args, escapeLike(query)+"%", "%"+escapeLike(strings.ToLower(query))+"%")
+		if phone := normalizePhone(query); len(phone) >= 5 {
+			sql += " OR c.phone LIKE ? ESCAPE '\\'"
+			args = append(args, "%"+escapeLike(strings.TrimPrefix(phone, "+"))+"%")
+		}
+	}
+	sql += " GROUP BY c.id, c.surname, c.name, c.phone, c.email, c.created_at ORDER BY c.surname, c.name"
+	var rows []customerSummary
+	err := db().WithContext(ctx).Raw(sql, args...).Scan(&rows).Error
+	return rows, err
+}
+
+// renderCustomers выводит реестр заказчиков
+func renderCustomers(ctx context.Context, w http.ResponseWriter, query, message string) {
+	data := map[string]interface{}{"Message": message, "Query": query}
+	if currentRole != "admin" {
+		data["Message"] = "Реестр заказчиков доступен только администратору."
+	} else if customers, err := listCustomers(ctx, query); err != nil {
+		data["Message"] = "Ошибка получения заказчиков: " + describeQueryError(ctx, err)
+	} else {
+		data["Customers"] = customers
+	}
+	if err := tmpl.ExecuteTemplate(w, "customers.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderCustomer выводит карточку заказчика с историей заказов
+func renderCustomer(ctx context.Context, w http.ResponseWriter, id int, message string) {
+	if currentRole != "admin" {
+		renderCustomers(ctx, w, "", "")
+		return
+	}
+	var c customer
+	if err := db().WithContext(ctx).First(&c, id).Error; err != nil {
+		renderCustomers(ctx, w, "", "Заказчик не найден.")
+		return
+	}
+	data := map[string]interface{}{"Customer": c}
+	var messages []string
+	if message != "" {
+		messages = append(messages, message)
+	}
+	var orders []orderSummary
+	err := db().WithContext(ctx).Raw(orderSummarySelect+" WHERE co.customer_id = ? ORDER BY o.OrderDate DESC", id).Scan(&orders).Error
+	if err != nil {
+		messages = append(messages, "Ошибка получения заказов: "+describeQueryError(ctx, err))
+	}
+	data["Orders"] = orders
+	books, err := queryResultSet(ctx, "Заказанные книги", `
+        SELECT l.book_code AS BookCode, b.Name AS [Название], SUM(l.quantity) AS [Экземпляров], COUNT(DISTINCT l.order_id) AS [Заказов]
+        FROM app_customer_orders co
+        JOIN app_order_lines l ON l.order_id = co.order_id
+        LEFT JOIN app_order_states s ON s.order_id = co.order_id
+        LEFT JOIN Books b ON b.BookCode = l.book_code
+        WHERE co.customer_id = ? AND COALESCE(s.status, 'legacy') <> ?
+        GROUP BY l.book_code, b.Name
+        ORDER BY b.Name`, id, orderCancelled)
+	if err != nil {
+		messages = append(messages, "Ошибка получения книг: "+describeQueryError(ctx, err))
+	} else {
+		data["Books"] = books
+	}
+	var customers []customer
+	if err := db().WithContext(ctx).Find(&customers).Error; err == nil {
+		data["Matches"] = findCustomerMatches(customers, c)
+	}
+	data["Message"] = strings.Join(messages, " ")
+	if err := tmpl.ExecuteTemplate(w, "customer_view.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderCustomerMigration выводит непривязанные строки CustomerInfo с разбором и совпадениями
+func renderCustomerMigration(ctx context.Context, w http.ResponseWriter, message string) {
+	data := map[string]interface{}{"Message": message}
+	if currentRole != "admin" {
+		data["Message"] = "Перенос заказчиков доступен только администратору."
+	} else if pending, err := loadPendingCustomerInfos(ctx); err != nil {
+		data["Message"] = strings.TrimSpace(message + " Ошибка разбора заказчиков: " + describeQueryError(ctx, err))
+	} else {
+		data["Pending"] = pending
+	}
+	if err := tmpl.ExecuteTemplate(w, "customer_migration.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// customerFromForm читает поля карточки из формы
+func customerFromForm(form url.Values) customer {
+	return customer{
+		Surname: form.Get("surname"),
+		Name:    form.Get("name"),
+		Phone:   form.Get("phone"),
+		Email:   form.Get("email"),
+	}
+}
+
+func registerCustomerHandlers() {
+	http.HandleFunc("/customers", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderCustomers(ctx, w, r.URL.Query().Get("q"), "")
+	})
+
+	http.HandleFunc("/customer", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderCustomers(ctx, w, "", "Некорректный номер заказчика.")
+			return
+		}
+		renderCustomer(ctx, w, id, "")
+	})
+
+	// создание и изменение карточки
+	http.HandleFunc("/customer_update", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderCustomers(ctx, w, "", "Ошибка при обработке формы.")
+			return
+		}
+		c := customerFromForm(r.Form)
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if id != 0 {
+			var existing customer
+			if err := db().WithContext(ctx).First(&existing, id).Error; err != nil {
+				renderCustomers(ctx, w, "", "Заказчик не найден.")
+				return
+			}
+			c.ID, c.CreatedAt = existing.ID, existing.CreatedAt
+		}
+		if err := saveCustomer(ctx, &c); err != nil {
+			if id != 0 {
+				renderCustomer(ctx, w, id, "Ошибка сохранения: "+describeQueryError(ctx, err))
+			} else {
+				renderCustomers(ctx, w, "", "Ошибка сохранения: "+describeQueryError(ctx, err))
+			}
+			return
+		}
+		renderCustomer(ctx, w, int(c.ID), "✅ Карточка заказчика сохранена.")
+	})
+
+	http.HandleFunc("/customer_migration", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderCustomerMigration(ctx, w, "")
+	})
+
+	// перенос строки CustomerInfo: новая карточка, привязка к существующей или все строки без совпадений
+	http.HandleFunc("/customer_migrate", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderCustomerMigration(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		info := r.FormValue("info")
+		switch r.FormValue("action") {
+		case "create":
+			c := customerFromForm(r.Form)
+			var linked int64
+			err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := validateCustomer(tx, &c); err != nil {
+					return err
+				}
+				if err := tx.Create(&c).Error; err != nil {
+					return err
+				}
+				if err := writeAudit(tx, "create", "customer", strconv.Itoa(int(c.ID)), c.CustomerInfo()); err != nil {
+					return err
+				}
+				var err error
+				linked, err = linkOrdersByInfo(tx, info, c.ID)
+				return err
+			})
+			if err != nil {
+				renderCustomerMigration(ctx, w, "Ошибка создания карточки: "+describeQueryError(ctx, err))
+				return
+			}
+			renderCustomerMigration(ctx, w, fmt.Sprintf("✅ Карточка «%s» создана, привязано заказов: %d.", c.FullName(), linked))
+		case "link":
+			customerID, err := strconv.Atoi(r.FormValue("customerID"))
+			if err != nil {
+				renderCustomerMigration(ctx, w, "Выберите заказчика.")
+				return
+			}
+			var linked int64
+			err = db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				var c customer
+				if err := tx.First(&c, customerID).Error; err != nil {
+					return errors.New("заказчик не найден")
+				}
+				var err error
+				linked, err = linkOrdersByInfo(tx, info, c.ID)
+				return err
+			})
+			if err != nil {
+				renderCustomerMigration(ctx, w, "Ошибка привязки заказов: "+describeQueryError(ctx, err))
+				return
+			}
+			renderCustomerMigration(ctx, w, fmt.Sprintf("✅ Привязано заказов: %d.", linked))
+		case "create_all":
+			created, err := createCustomersWithoutMatches(ctx)
+			if err != nil {
+				renderCustomerMigration(ctx, w, "Ошибка создания карточек: "+describeQueryError(ctx, err))
+				return
+			}
+			renderCustomerMigration(ctx, w, fmt.Sprintf("✅ Создано карточек: %d. Строки с совпадениями разберите вручную.", created))
+		default:
+			renderCustomerMigration(ctx, w, "Неизвестное действие.")
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"8 (912) 345-67-89", "+79123456789"},
+		{"+7 912 345 67 89", "+79123456789"},
+		{"79123456789", "+79123456789"},
+		{"912-345-67-89", "+79123456789"},
+		{"+375 29 123-45-67", "+375291234567"},
+		{"345-67-89", "+3456789"},
+		{"", ""},
+		{"нет", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizePhone(tt.in); got != tt.want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCustomerInfo(t *testing.T) {
+	tests := []struct {
+		info string
+		want customer
+	}{
+		{"Иванов Иван", customer{Surname: "Иванов", Name: "Иван"}},
+		{"ПЕТРОВА анна сергеевна", customer{Surname: "Петрова", Name: "Анна Сергеевна"}},
+		{"Сидоров, тел. 8-912-345-67-89", customer{Surname: "Сидоров", Phone: "+79123456789"}},
+		{"Римский-Корсаков Н. А., Ivan@Example.COM", customer{Surname: "Римский-Корсаков", Name: "Н А", Email: "ivan@example.com"}},
+		{"Кузнецов Петр +7 (912) 000-11-22 kuznetsov@mail.ru", customer{Surname: "Кузнецов", Name: "Петр", Phone: "+79120001122", Email: "kuznetsov@mail.ru"}},
+		{"тел 89123456789", customer{Phone: "+79123456789"}},
+		{"", customer{}},
+	}
+	for _, tt := range tests {
+		got := parseCustomerInfo(tt.info)
+		if got.Surname != tt.want.Surname || got.Name != tt.want.Name || got.Phone != tt.want.Phone || got.Email != tt.want.Email {
+			t.Errorf("parseCustomerInfo(%q) = {%q %q %q %q}, want {%q %q %q %q}", tt.info,
+				got.Surname, got.Name, got.Phone, got.Email, tt.want.Surname, tt.want.Name, tt.want.Phone, tt.want.Email)
+		}
+	}
+}
+
+func TestValidPhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"8 (912) 345-67-89", true},
+		{"+375 29 123-45-67", true},
+		{"345-67-89", true},
+		{"45-67-89", false},
+		{"+7 912 345 67 89 доб. 12345678", false},
+		{"1234567890123456789012", false},
+		{"нет", false},
+	}
+	for _, tt := range tests {
+		if got := validPhone(normalizePhone(tt.in)); got != tt.want {
+			t.Errorf("validPhone(normalizePhone(%q)) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const defaultStatementTimeout = 30 * time.Second
+
+// statementTimeout возвращает таймаут запросов к базе для endpoint из config.json
+func statementTimeout(path string) time.Duration {
+	if d, ok := config.statementTimeouts[path]; ok {
+		return d
+	}
+	if d, ok := config.statementTimeouts["default"]; ok {
+		return d
+	}
+	return defaultStatementTimeout
+}
+
+// queryContext создает контекст запроса к базе, который отменяется вместе с HTTP-запросом
+// или по истечении таймаута endpoint. При отмене драйвер отправляет SQL Server сигнал attention,
+// и выполнение оператора на сервере прерывается.
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), statementTimeout(r.URL.Path))
+}
+
+// describeQueryError формирует понятное сообщение об ошибке, отличая таймаут и отмену от ошибок SQL
+func describeQueryError(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded):
+		return "превышено допустимое время выполнения, запрос отменен на сервере"
+	case errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, context.Canceled):
+		return "запрос отменен, так как соединение с браузером было закрыто"
+	}
+	return err.Error()
+}
+
+// parseTimeouts разбирает таймауты вида "30s" или "5m" из конфигурации
+func parseTimeouts(raw map[string]string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration, len(raw))
+	for path, value := range raw {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("некорректный таймаут %q для %s", value, path)
+		}
+		timeouts[path] = d
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// writeCSV записывает наборы строк в CSV; каждый набор предваряется строкой с заголовком
+func writeCSV(w io.Writer, sets []*resultSet) error {
+	// BOM нужен, чтобы Excel правильно распознал кириллицу
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	for i, rs := range sets {
+		if i > 0 {
+			cw.Write(nil)
+		}
+		if rs.Title != "" {
+			cw.Write([]string{rs.Title})
+		}
+		cw.Write(rs.Columns)
+		for _, row := range rs.Rows {
+			record := make([]string, len(row))
+			for j, v := range row {
+				record[j] = formatCell(v)
+			}
+			cw.Write(record)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCell приводит значение ячейки к строке для экспорта
+func formatCell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if val.Hour() == 0 && val.Minute() == 0 && val.Second() == 0 {
+			return val.Format("2006-01-02")
+		}
+		return val.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonResultSet - представление набора строк для экспорта в JSON
+type jsonResultSet struct {
+	Title   string          `json:"title,omitempty"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+func toJSONResultSets(sets []*resultSet) []jsonResultSet {
+	out := make([]jsonResultSet, 0, len(sets))
+	for _, rs := range sets {
+		rows := rs.Rows
+		if rows == nil {
+			rows = [][]interface{}{}
+		}
+		out = append(out, jsonResultSet{Title: rs.Title, Columns: rs.Columns, Rows: rows})
+	}
+	return out
+}
+
+// writeJSON записывает произвольное значение в JSON с отступами
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// setDownloadHeaders задает заголовки ответа для скачивания файла
+func setDownloadHeaders(w http.ResponseWriter, filename, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
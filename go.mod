@@ -3,17 +3,17 @@ module mssqlconnect
 go 1.20
 
 require (
+	github.com/golang-sql/sqlexp v0.1.0
+	github.com/microsoft/go-mssqldb v1.7.2
 	github.com/shopspring/decimal v1.4.0
+	golang.org/x/text v0.14.0
 	gorm.io/driver/sqlserver v1.5.4
 	gorm.io/gorm v1.25.12
 )
 
 require (
 	github.com/golang-sql/civil v0.0.0-20220223132316-b832511892a9 // indirect
-	github.com/golang-sql/sqlexp v0.1.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
-	github.com/microsoft/go-mssqldb v1.7.2 // indirect
 	golang.org/x/crypto v0.18.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backgroundJob - процедура, запрос или выгрузка отчета, выполняемые в фоне
+type backgroundJob struct {
+	ID          uint   `gorm:"primaryKey"`
+	Kind        string `gorm:"size:20"` // report, query или procedure
+	Target      string `gorm:"size:300"`
+	Params      string `gorm:"size:2000"` // значения параметров в виде строки запроса URL
+	Format      string `gorm:"size:10"`
+	Title       string `gorm:"size:300"`
+	Status      string `gorm:"size:20;index"` // queued, running, done, failed или cancelled
+	Stage       string `gorm:"size:200"`      // что выполняется сейчас
+	Rows        int
+	Error       string `gorm:"size:2000"`
+	SubmittedBy string `gorm:"size:100"`
+	SubmittedAs string `gorm:"size:20"` // роль автора; под подключением с меньшими правами задание не выполняется
+	CreatedAt   time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+	FileName    string `gorm:"size:300"` // имя файла для скачивания
+	ContentType string `gorm:"size:100"`
+	Size        int64
+	ExpiresAt   *time.Time // после этого результат удаляется
+}
+
+func (backgroundJob) TableName() string { return "app_jobs" }
+
+func init() {
+	registerModels(&backgroundJob{})
+}
+
+var jobStatusLabels = map[string]string{
+	"queued":    "в очереди",
+	"running":   "выполняется",
+	"done":      "готово",
+	"failed":    "ошибка",
+	"cancelled": "отменено",
+}
+
+// jobFormats - форматы результата фонового задания: документы, как у расписаний, и JSON для выгрузок
+var jobFormats = map[string]string{
+	"csv":  "CSV",
+	"pdf":  "PDF",
+	"html": "HTML",
+	"json": "JSON",
+}
+
+// StatusLabel - состояние задания по-русски
+func (j backgroundJob) StatusLabel() string { return jobStatusLabels[j.Status] }
+
+// Active - задание еще в очереди или выполняется
+func (j backgroundJob) Active() bool { return j.Status == "queued" || j.Status == "running" }
+
+// Elapsed - сколько задание выполнялось или выполняется
+func (j backgroundJob) Elapsed() string {
+	if j.StartedAt == nil {
+		return "—"
+	}
+	end := time.Now()
+	if j.FinishedAt != nil {
+		end = *j.FinishedAt
+	}
+	return end.Sub(*j.StartedAt).Round(time.Second).String()
+}
+
+// resultPath - файл с результатом задания
+func (j backgroundJob) resultPath() string {
+	return filepath.Join(config.Jobs.ResultDir, strconv.Itoa(int(j.ID))+filepath.Ext(j.FileName))
+}
+
+var (
+	jobQueue = make(chan uint, 100)
+
+	// jobHandles - задания, которые стоят в очереди или выполняются в этом процессе
+	jobHandles   = map[uint]jobHandle{}
+	jobHandlesMu sync.Mutex
+)
+
+// jobHandle - контекст задания; отмена прерывает выполняющийся запрос на сервере
+type jobHandle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// targetAllowed проверяет, доступен ли отчет, запрос или процедура текущей роли
+func targetAllowed(kind, target string) bool {
+	switch kind {
+	case "report":
+		rd := findReport(target)
+		return rd != nil && rd.AllowedFor(currentRole)
+	case "query":
+		qd := findQuery(target)
+		return qd != nil && qd.AllowedFor(currentRole)
+	case "procedure":
+		return currentRole == "admin"
+	}
+	return false
+}
+
+// submitJob проверяет параметры и ставит задание в очередь; в params могут быть и другие поля формы
+func submitJob(ctx context.Context, kind, target, format string, form url.Values) (*backgroundJob, error) {
+	if !targetAllowed(kind, target) {
+		return nil, errors.New("недоступно для вашей роли")
+	}
+	if _, ok := jobFormats[format]; !ok {
+		return nil, errors.New("неизвестный формат результата")
+	}
+	params, title, err := targetFormParams(ctx, kind, target, form)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &backgroundJob{
+		Kind: kind, Target: target, Params: params.Encode(), Format: format, Title: title,
+		Status: "queued", Stage: "ожидает свободного исполнителя", SubmittedBy: currentUser,
+		SubmittedAs: currentRole,
+	}
+	jobHandlesMu.Lock()
+	defer jobHandlesMu.Unlock()
+	if len(jobQueue) == cap(jobQueue) {
+		return nil, errors.New("очередь заданий заполнена, попробуйте позже")
+	}
+	if err := db().WithContext(ctx).Create(job).Error; err != nil {
+		return nil, err
+	}
+	jobCtx, cancel := context.WithCancel(context.Background())
+	jobHandles[job.ID] = jobHandle{ctx: jobCtx, cancel: cancel}
+	jobQueue <- job.ID
+	return job, nil
+}
+
+// cancelJob отменяет задание: из очереди оно убирается, выполняющийся запрос прерывается на сервере
+func cancelJob(ctx context.Context, id uint) error {
+	jobHandlesMu.Lock()
+	h, ok := jobHandles[id]
+	jobHandlesMu.Unlock()
+	if !ok {
+		return errors.New("задание уже завершено")
+	}
+	h.cancel()
+	now := time.Now()
+	// Задание из очереди помечаем сразу; выполняющееся отметит исполнитель, когда запрос прервется
+	return db().WithContext(ctx).Model(&backgroundJob{}).Where("id = ? AND status = ?", id, "queued").
+		Updates(map[string]interface{}{"status": "cancelled", "stage": "", "finished_at": now}).Error
+}
+
+// startJobWorkers запускает исполнителей заданий и очистку устаревших результатов
+func startJobWorkers() {
+	for i := 0; i < config.Jobs.Workers; i++ {
+		go func() {
+			for id := range jobQueue {
+				runJob(id)
+			}
+		}()
+	}
+	go runJobCleanup()
+}
+
+// runJob выполняет задание из очереди и сохраняет результат в каталог заданий
+func runJob(id uint) {
+	jobHandlesMu.Lock()
+	h, ok := jobHandles[id]
+	jobHandlesMu.Unlock()
+	if !ok {
+		return
+	}
+	defer func() {
+		jobHandlesMu.Lock()
+		delete(jobHandles, id)
+		jobHandlesMu.Unlock()
+		h.cancel()
+	}()
+	jobCtx := h.ctx
+	if jobCtx.Err() != nil {
+		return // отменено, пока стояло в очереди
+	}
+
+	var job backgroundJob
+	if err := db().First(&job, id).Error; err != nil || job.Status != "queued" {
+		return
+	}
+	started := time.Now()
+	job.Status, job.Stage, job.StartedAt = "running", "выполняется "+strings.ToLower(targetKinds[job.Kind]), &started
+	db().Save(&job)
+
+	err := func() error {
+		if !roleCovers(dbRole(), job.SubmittedAs) {
+			return errors.New("подключение к базе сменилось на пользователя с другой ролью, задание не выполнено")
+		}
+		ctx, cancel := context.WithTimeout(jobCtx, statementTimeout("/jobs"))
+		defer cancel()
+		params, err := url.ParseQuery(job.Params)
+		if err != nil {
+			return err
+		}
+		_, sets, err := executeTarget(ctx, job.Kind, job.Target, params)
+		if err != nil {
+			if errors.Is(jobCtx.Err(), context.Canceled) {
+				return err
+			}
+			return errors.New(describeQueryError(ctx, err))
+		}
+		for _, rs := range sets {
+			job.Rows += len(rs.Rows)
+		}
+		job.Stage = fmt.Sprintf("формируется файл, строк: %d", job.Rows)
+		db().Model(&job).Updates(map[string]interface{}{"stage": job.Stage, "rows": job.Rows})
+
+		data, ext, contentType, err := renderDocument(job.Format, job.Title, sets)
+		if err != nil {
+			return err
+		}
+		job.FileName = documentFileName(job.Title, started, ext)
+		job.ContentType = contentType
+		job.Size = int64(len(data))
+		if err := os.MkdirAll(config.Jobs.ResultDir, 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(job.resultPath(), data, 0o644)
+	}()
+
+	finished := time.Now()
+	job.FinishedAt, job.Stage = &finished, ""
+	switch {
+	case err != nil && errors.Is(jobCtx.Err(), context.Canceled):
+		job.Status, job.Error, job.FileName = "cancelled", "", ""
+	case err != nil:
+		job.Status, job.Error, job.FileName = "failed", truncateText(err.Error(), 2000), ""
+	default:
+		expires := finished.Add(config.Jobs.retention)
+		job.Status, job.ExpiresAt = "done", &expires
+	}
+	db().Save(&job)
+}
+
+// runJobCleanup раз в 10 минут удаляет задания и файлы старше срока хранения.
+// Задания, которые остались в очереди или выполнялись до перезапуска сервера, помечаются ошибкой.
+func runJobCleanup() {
+	for {
+		time.Sleep(10 * time.Minute)
+		conn := db()
+		if conn == nil {
+			continue
+		}
+		var jobs []backgroundJob
+		if err := conn.Where("status IN ?", []string{"queued", "running"}).Find(&jobs).Error; err != nil {
+			continue // таблицы еще не созданы или база недоступна
+		}
+		jobHandlesMu.Lock()
+		for _, j := range jobs {
+			if _, ok := jobHandles[j.ID]; !ok {
+				conn.Model(&j).Updates(map[string]interface{}{
+					"status": "failed", "stage": "", "error": "прервано перезапуском сервера", "finished_at": time.Now(),
+				})
+			}
+		}
+		jobHandlesMu.Unlock()
+
+		var expired []backgroundJob
+		conn.Where("finished_at < ?", time.Now().Add(-config.Jobs.retention)).Find(&expired)
+		for _, j := range expired {
+			if j.FileName != "" {
+				if err := os.Remove(j.resultPath()); err != nil && !os.IsNotExist(err) {
+					fmt.Println("Ошибка удаления результата задания:", err)
+					continue
+				}
+			}
+			conn.Delete(&j)
+		}
+	}
+}
+
+// findJob ищет задание, доступное текущему пользователю: администратору - любое, остальным - свои
+func findJob(ctx context.Context, id int) (*backgroundJob, error) {
+	var job backgroundJob
+	if err := db().WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	if currentRole != "admin" && job.SubmittedBy != currentUser {
+		return nil, errors.New("задание недоступно")
+	}
+	return &job, nil
+}
+
+// renderJobs выводит задания текущего пользователя, администратору - все
+func renderJobs(ctx context.Context, w http.ResponseWriter, message string) {
+	data := map[string]interface{}{
+		"Message":   message,
+		"IsAdmin":   currentRole == "admin",
+		"Retention": config.Jobs.Retention,
+	}
+	q := db().WithContext(ctx).Order("id DESC").Limit(200)
+	if currentRole != "admin" {
+		q = q.Where("submitted_by = ?", currentUser)
+	}
+	var jobs []backgroundJob
+	if err := q.Find(&jobs).Error; err != nil {
+		data["Message"] = strings.TrimSpace(message + " Ошибка получения заданий: " + describeQueryError(ctx, err))
+	}
+	active := false
+	for _, j := range jobs {
+		active = active || j.Active()
+	}
+	data["Jobs"] = jobs
+	data["Refresh"] = active
+	if err := tmpl.ExecuteTemplate(w, "jobs.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderJob выводит задание; пока оно не завершено, страница обновляется сама
+func renderJob(ctx context.Context, w http.ResponseWriter, id int, message string) {
+	job, err := findJob(ctx, id)
+	if err != nil {
+		renderJobs(ctx, w, "Задание не найдено.")
+		return
+	}
+	values, _ := url.ParseQuery(job.Params)
+	data := map[string]interface{}{
+		"Message": message,
+		"Job":     job,
+		"Kind":    targetKinds[job.Kind],
+		"Params":  paramsText(values),
+	}
+	if err := tmpl.ExecuteTemplate(w, "job_view.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerJobHandlers() {
+	http.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderJobs(ctx, w, "")
+	})
+
+	http.HandleFunc("/job", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderJobs(ctx, w, "Некорректный номер задания.")
+			return
+		}
+		renderJob(ctx, w, id, "")
+	})
+
+	// состояние задания в JSON для опроса из скриптов
+	http.HandleFunc("/job_status", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		job, err := findJob(ctx, id)
+		if err != nil {
+			http.Error(w, "Задание не найдено", http.StatusNotFound)
+			return
+		}
+		status := map[string]interface{}{
+			"id":     job.ID,
+			"status": job.Status,
+			"stage":  job.Stage,
+			"rows":   job.Rows,
+			"error":  job.Error,
+		}
+		if job.Status == "done" {
+			status["download"] = fmt.Sprintf("/job_result?id=%d", job.ID)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writeJSON(w, status)
+	})
+
+	// постановка в очередь: jobKind, jobTarget и jobFormat, остальные поля формы - параметры
+	http.HandleFunc("/job_submit", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil {
+			renderJobs(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		job, err := submitJob(ctx, r.FormValue("jobKind"), r.FormValue("jobTarget"), r.FormValue("jobFormat"), r.Form)
+		if err != nil {
+			renderJobs(ctx, w, "Задание не поставлено в очередь: "+describeQueryError(ctx, err))
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/job?id=%d", job.ID), http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/job_cancel", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if r.Method != http.MethodPost {
+			renderJobs(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if _, err := findJob(ctx, id); err != nil {
+			renderJobs(ctx, w, "Задание не найдено.")
+			return
+		}
+		if err := cancelJob(ctx, uint(id)); err != nil {
+			renderJob(ctx, w, id, "Ошибка отмены: "+describeQueryError(ctx, err))
+			return
+		}
+		renderJob(ctx, w, id, "✅ Задание отменено.")
+	})
+
+	// скачивание результата; inline=1 открывает HTML и PDF в браузере
+	http.HandleFunc("/job_result", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		job, err := findJob(ctx, id)
+		if err != nil || job.Status != "done" {
+			renderJobs(ctx, w, "Результат задания не найден.")
+			return
+		}
+		data, err := os.ReadFile(job.resultPath())
+		if err != nil {
+			renderJob(ctx, w, id, "Файл результата не найден: возможно, истек срок хранения.")
+			return
+		}
+		if r.URL.Query().Get("inline") == "1" {
+			w.Header().Set("Content-Type", job.ContentType)
+		} else {
+			setDownloadHeaders(w, job.FileName, job.ContentType)
+		}
+		w.Write(data)
+	})
+}
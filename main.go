@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/driver/sqlserver"
@@ -12,12 +15,46 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-var db *gorm.DB
+// dbSession - подключение к базе и роль пользователя, под которым оно открыто
+type dbSession struct {
+	conn *gorm.DB
+	role string
+}
+
+// Подключение к базе. Его заменяет /connect после успешного входа, а читают обработчики и фоновые
+// планировщики, поэтому указатель хранится атомарно; до первого подключения db() возвращает nil.
+var dbConn atomic.Pointer[dbSession]
+
+func db() *gorm.DB {
+	if s := dbConn.Load(); s != nil {
+		return s.conn
+	}
+	return nil
+}
+
+// dbRole - роль, под которой открыто текущее подключение; пустая строка - подключения нет
+func dbRole() string {
+	if s := dbConn.Load(); s != nil {
+		return s.role
+	}
+	return ""
+}
+
+// roleCovers проверяет, можно ли выполнить под ролью подключения то, что создано под ролью owner:
+// администратору доступно все, пользователю - только созданное пользователем
+func roleCovers(connRole, owner string) bool {
+	return connRole == "admin" || connRole != "" && connRole == owner
+}
+
 var tmpl *template.Template
 
+// Текущий пользователь и его роль, определяются при подключении
+var currentUser string
+var currentRole string
+
 func init() {
 	var err error
-	tmpl, err = template.ParseFiles("template.html", "combined_view.html", "admin_main.html", "admin_view.html", "admin_edit.html", "admin_reports.html", "report_view.html", "user_reports.html", "queries.html", "query_result.html", "admin_procedures.html", "procedure_result.html") // Загрузка шаблонов
+	tmpl, err = template.ParseFiles("template.html", "combined_view.html", "admin_main.html", "admin_view.html", "admin_edit.html", "admin_reports.html", "report_view.html", "user_reports.html", "queries.html", "query_result.html", "admin_procedures.html", "procedure_result.html", "pos.html", "pos_receipt.html", "orders.html", "order_view.html", "stock_alerts.html", "receiving.html", "receiving_view.html", "stocktake.html", "stocktake_view.html", "audit_log.html", "catalogue.html", "book_view.html", "search.html", "authors.html", "author_view.html", "classifier.html", "performance.html", "commission.html", "commission_statement.html", "analytics.html", "valuation.html", "pricing.html", "publishers.html", "publisher_view.html", "customers.html", "customer_view.html", "customer_migration.html", "schedules.html", "schedule_view.html", "report_document.html", "jobs.html", "job_view.html", "saved_reports.html", "sql_console.html") // Загрузка шаблонов
 	if err != nil {
 		panic("Ошибка загрузки шаблонов: " + err.Error())
 	}
@@ -34,15 +71,15 @@ func containsSQLKeywords(input string) bool {
 }
 
 // Функция для получения роли пользователя
-func getUserRole(login string) (string, error) {
+func getUserRole(ctx context.Context, conn *gorm.DB, login string) (string, error) {
 	var role string
 	// Попытка получить роль через таблицу users
-	err := db.Table("users").Select("user_roles").Where("login = ?", login).Scan(&role).Error
+	err := conn.WithContext(ctx).Table("users").Select("user_roles").Where("login = ?", login).Scan(&role).Error
 	if err == nil {
 		return role, nil // Если запрос успешен, возвращаем роль
 	}
 	// Если запрос к users не удался, пробуем получить данные через представление v_user3_view
-	err = db.Table("v_user3_view").Select("user_roles").Where("login = ?", login).Scan(&role).Error
+	err = conn.WithContext(ctx).Table("v_user3_view").Select("user_roles").Where("login = ?", login).Scan(&role).Error
 	if err != nil {
 		return "", fmt.Errorf("Ошибка проверки роли пользователя: %w", err)
 	}
@@ -51,9 +88,9 @@ func getUserRole(login string) (string, error) {
 }
 
 // Получение столбцов таблицы
-func getTableColumns(tableName string) ([]string, error) {
+func getTableColumns(ctx context.Context, tableName string) ([]string, error) {
 	var columns []string
-	err := db.Raw(`
+	err := db().WithContext(ctx).Raw(`
         SELECT COLUMN_NAME
         FROM INFORMATION_SCHEMA.COLUMNS
         WHERE TABLE_NAME = ?
@@ -93,6 +130,24 @@ func ConvertToDecimal(value interface{}) (string, error) {
 	return "", fmt.Errorf("unsupported type: %T", value)
 }
 
+// Таблицы главной страницы для каждой роли
+var (
+	userTables  = []string{"Classifier", "Publishers", "Books", "Authors", "AuthorNames", "Editions", "Warehouse"}
+	adminTables = []string{"Classifier", "Publishers", "Books", "Authors", "AuthorNames", "Editions", "Warehouse", "Orders", "Sales", "Employees"}
+)
+
+// renderHome выводит главную страницу роли с таблицами и закрепленными отчетами; без подключения - форму входа
+func renderHome(ctx context.Context, w http.ResponseWriter, message string) {
+	switch {
+	case db() == nil:
+		tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": message})
+	case currentRole == "admin":
+		tmpl.ExecuteTemplate(w, "admin_main.html", map[string]interface{}{"Tables": adminTables, "Pinned": pinnedReports(ctx), "Message": message})
+	default:
+		tmpl.ExecuteTemplate(w, "combined_view.html", map[string]interface{}{"Tables": userTables, "Pinned": pinnedReports(ctx), "Message": message})
+	}
+}
+
 func main() {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		tmpl.ExecuteTemplate(w, "template.html", nil)
@@ -125,37 +180,58 @@ func main() {
 			return
 		}
 
-		db = dbTemp
+		// Прежнее подключение остается рабочим, пока новое не проверено: им пользуются фоновые запуски
+		sqlDB, _ := dbTemp.DB()
+		ctx, cancel := queryContext(r)
+		defer cancel()
 
-		sqlDB, _ := db.DB()
-		err = sqlDB.Ping()
+		err = sqlDB.PingContext(ctx)
 		if err != nil {
-			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Не удалось подключиться: " + err.Error()})
+			sqlDB.Close()
+			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Не удалось подключиться: " + describeQueryError(ctx, err)})
 			return
 		}
 
 		// Получение роли пользователя
-		role, err := getUserRole(user)
+		role, err := getUserRole(ctx, dbTemp, user)
 		if err != nil {
-			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Ошибка получения роли пользователя: " + err.Error()})
+			sqlDB.Close()
+			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Ошибка получения роли пользователя: " + describeQueryError(ctx, err)})
+			return
+		}
+		if role != "user" && role != "admin" {
+			sqlDB.Close()
+			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Роль пользователя неизвестна или доступ запрещён!"})
 			return
 		}
 
-		if role == "user" {
-			tables := []string{"Classifier", "Publishers", "Books", "Authors", "AuthorNames", "Editions", "Warehouse"}
-			tmpl.ExecuteTemplate(w, "combined_view.html", map[string]interface{}{"Tables": tables, "Message": "✅ Успешное подключение как пользователь!"})
-		} else if role == "admin" {
-			tables := []string{"Classifier", "Publishers", "Books", "Authors", "AuthorNames", "Editions", "Warehouse", "Orders", "Sales", "Employees"}
-			tmpl.ExecuteTemplate(w, "admin_main.html", map[string]interface{}{"Tables": tables, "Message": "✅ Успешное подключение как администратор!"})
+		dbConn.Store(&dbSession{conn: dbTemp, role: role})
+		currentUser = user
+		currentRole = role
+
+		if role == "admin" {
+			if err := migrateAppTables(ctx); err != nil {
+				fmt.Println(err)
+			}
+			renderHome(ctx, w, "✅ Успешное подключение как администратор!")
 		} else {
-			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Роль пользователя неизвестна или доступ запрещён!"})
+			renderHome(ctx, w, "✅ Успешное подключение как пользователь!")
 		}
 	})
 
+	http.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderHome(ctx, w, "")
+	})
+
 	// Обработчик для admin_view
 	http.HandleFunc("/admin_view", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
 		if err := r.ParseForm(); err != nil {
-			tmpl.ExecuteTemplate(w, "admin_main.html", map[string]string{"Message": "Ошибка парсинга формы"})
+			renderHome(ctx, w, "Ошибка парсинга формы")
 			return
 		}
 
@@ -163,9 +239,9 @@ func main() {
 		fmt.Println("Просмотр таблицы:", tableName)
 
 		var records []map[string]interface{}
-		err := db.Table(tableName).Find(&records).Error
+		err := db().WithContext(ctx).Table(tableName).Find(&records).Error
 		if err != nil {
-			tmpl.ExecuteTemplate(w, "admin_main.html", map[string]string{"Message": "Ошибка выполнения запроса: " + err.Error()})
+			renderHome(ctx, w, "Ошибка выполнения запроса: "+describeQueryError(ctx, err))
 			return
 		}
 
@@ -179,209 +255,39 @@ func main() {
 	// выбор отчетов для админа
 	http.HandleFunc("/admin_reports", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("Запрос к /admin_reports")
-		// Формируем контекст для выбора отчета
-		data := map[string]interface{}{
-			"Message": "Выберите отчет для просмотра.",
-			"Reports": []string{
-				"Отчет по продажам сотрудника",
-				"Список книг по автору",
-				"Книги по разделу классификатора на складе",
-			},
-		}
-		tmpl.ExecuteTemplate(w, "admin_reports.html", data)
+		renderReportList(w, "admin_reports.html", "Выберите отчет для просмотра.")
 	})
 	http.HandleFunc("/view_report", func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			tmpl.ExecuteTemplate(w, "admin_reports.html", map[string]string{"Message": "Ошибка при выборе отчета."})
-			return
-		}
-
-		reportType := r.FormValue("reportType")
-		filterValue := r.FormValue("filterValue") // Получаем значение, введенное пользователем
-		var reportData []map[string]interface{}
-		var query string
-		if containsSQLKeywords(filterValue) {
-			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Ошибка: Вводить SQL-запросы в поля пользователь и пароль запрещено!"})
-			return
-		}
-		// Формируем запрос в зависимости от типа отчета
-		switch reportType {
-		case "v_SalesByEmployeeAndDate":
-			query = fmt.Sprintf("SELECT * FROM v_SalesByEmployeeAndDate WHERE FullName LIKE '%%%s%%'", filterValue)
-		case "v_BooksByAuthor":
-			query = fmt.Sprintf("SELECT * FROM v_BooksByAuthor WHERE FullName LIKE '%%%s%%'", filterValue) // LIKE для поиска
-		case "v_ClassifierBooksInWarehouse":
-			query = fmt.Sprintf("SELECT * FROM v_BooksInStockByClassifier WHERE Name LIKE '%%%s%%'", filterValue)
-		default:
-			tmpl.ExecuteTemplate(w, "admin_reports.html", map[string]string{"Message": "Неизвестный тип отчета."})
-			return
-		}
-
-		// Выполняем запрос
-		err := db.Raw(query).Scan(&reportData).Error
-		if err != nil {
-			tmpl.ExecuteTemplate(w, "admin_reports.html", map[string]string{"Message": "Ошибка получения данных из представления: " + err.Error()})
-			return
-		}
-
-		// Передаем данные в шаблон для отображения
-		data := map[string]interface{}{
-			"Message":    "✅ Данные успешно получены.",
-			"ReportType": reportType,
-			"ReportData": reportData,
-		}
-		tmpl.ExecuteTemplate(w, "report_view.html", data)
+		handleViewReport(w, r, "admin_reports.html")
 	})
 	// просмотр отчетов для пользователя
 	http.HandleFunc("/user_reports", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("Обработчик /user_reports вызван")
-
-		data := map[string]interface{}{
-			"Message": "Выберите отчет для просмотра.",
-		}
-
-		err := tmpl.ExecuteTemplate(w, "user_reports.html", data)
-		if err != nil {
-			fmt.Println("Ошибка выполнения шаблона:", err)
-			http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+		renderReportList(w, "user_reports.html", "Выберите отчет для просмотра.")
 	})
 	http.HandleFunc("/view_user_report", func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			tmpl.ExecuteTemplate(w, "user_reports.html", map[string]string{"Message": "Ошибка при выборе отчета."})
-			return
-		}
-
-		reportType := r.FormValue("reportType")
-		filterValue := r.FormValue("filterValue")
-		var reportData []map[string]interface{}
-		var query string
-
-		// Формируем запрос в зависимости от типа отчета
-		switch reportType {
-		case "v_BooksByAuthor":
-			query = fmt.Sprintf("SELECT * FROM v_BooksByAuthor WHERE FullName LIKE '%%%s%%'", filterValue)
-		case "v_ClassifierBooksInWarehouse":
-			query = fmt.Sprintf("SELECT * FROM v_BooksInStockByClassifier WHERE Name LIKE '%%%s%%'", filterValue)
-		default:
-			tmpl.ExecuteTemplate(w, "user_reports.html", map[string]string{"Message": "Неизвестный тип отчета."})
-			return
-		}
-
-		// Выполняем запрос
-		err := db.Raw(query).Scan(&reportData).Error
-		if err != nil {
-			tmpl.ExecuteTemplate(w, "user_reports.html", map[string]string{"Message": "Ошибка получения данных из представления: " + err.Error()})
-			return
-		}
-
-		// Передаем данные в шаблон для отображения
-		data := map[string]interface{}{
-			"Message":    "✅ Данные успешно получены.",
-			"ReportType": reportType,
-			"ReportData": reportData,
-		}
-		tmpl.ExecuteTemplate(w, "report_view.html", data)
+		handleViewReport(w, r, "user_reports.html")
 	})
 
 	//запросы
 	http.HandleFunc("/queries", func(w http.ResponseWriter, r *http.Request) {
-		data := map[string]interface{}{
-			"Message": "Выберите запрос и при необходимости введите значение.",
-		}
-		err := tmpl.ExecuteTemplate(w, "queries.html", data)
-		if err != nil {
-			http.Error(w, "Ошибка загрузки страницы запросов: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+		renderQueries(w, "Выберите запрос и при необходимости введите значение.", "", nil, nil)
 	})
 
-	http.HandleFunc("/execute_query", func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			tmpl.ExecuteTemplate(w, "queries.html", map[string]string{"Message": "Ошибка при отправке данных формы."})
-			return
-		}
-
-		queryType := r.FormValue("queryType")
-		inputValue := r.FormValue("inputValue")
-		var query string
-		var queryResult []map[string]interface{}
-
-		if containsSQLKeywords(inputValue) {
-			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Ошибка: Вводить SQL-запросы в поля пользователь и пароль запрещено!"})
-			return
-		}
-		// Define query logic based on the selected query type
-		switch queryType {
-		case "totalBookCost":
-			// Updated query to calculate total value of books in the warehouse
-			query = `
-            SELECT 
-                s.BookCode,
-                b.Name AS BookName,
-                SUM(s.Price * s.NumberOfCopies) AS TotalValue
-            FROM Warehouse s
-            JOIN Books b ON s.BookCode = b.BookCode
-            GROUP BY s.BookCode, b.Name;
-        `
-		case "employeeSalesCount":
-			query = `
-            SELECT e.FullName AS EmployeeName, SUM(s.Quantity) AS TotalSold
-            FROM Sales s
-            JOIN Employees e ON s.EmployeeID = e.EmployeeID
-            GROUP BY e.FullName
-        `
-		case "customersByLetter":
-			query = fmt.Sprintf(`
-            SELECT CustomerInfo
-            FROM Orders
-            WHERE CustomerInfo LIKE '%s%%'
-        `, inputValue) // Filtering by first letter
-		case "publishersByDate":
-			query = fmt.Sprintf(`
-            SELECT DISTINCT p.Name AS PublisherName, p.PublisherCode, s.SaleDate
-            FROM Sales s
-            JOIN Books b ON s.BookID = b.BookCode
-            JOIN Publishers p ON s.PublisherID = p.PublisherCode
-            WHERE s.SaleDate = '%s'
-        `, inputValue) // Filtering by date
-		case "booksSoldOnDate":
-			query = fmt.Sprintf(`
-            SELECT b.Name AS BookTitle, s.Quantity
-            FROM Sales s
-            JOIN Books b ON s.BookID = b.BookCode
-            WHERE s.SaleDate = '%s' AND s.IsOrder = 1
-        `, inputValue) // Filtering by date and preorder
-		default:
-			tmpl.ExecuteTemplate(w, "queries.html", map[string]string{"Message": "Неизвестный тип запроса."})
-			return
-		}
-
-		// Execute the query
-		err := db.Raw(query).Scan(&queryResult).Error
-		if err != nil {
-			tmpl.ExecuteTemplate(w, "queries.html", map[string]string{"Message": "Ошибка выполнения запроса: " + err.Error()})
-			return
-		}
-
-		// Render the query result
-		data := map[string]interface{}{
-			"Message":     "✅ Запрос выполнен успешно.",
-			"QueryResult": queryResult,
-		}
-		tmpl.ExecuteTemplate(w, "query_result.html", data)
-	})
+	http.HandleFunc("/execute_query", handleExecuteQuery)
 
 	// изменение строк
 	http.HandleFunc("/admin_edit", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
 		if r.Method == http.MethodGet {
 			tableName := r.URL.Query().Get("tableName")
 
 			var records []map[string]interface{}
-			err := db.Table(tableName).Find(&records).Error
+			err := db().WithContext(ctx).Table(tableName).Find(&records).Error
 			if err != nil {
-				tmpl.ExecuteTemplate(w, "admin_main.html", map[string]string{"Message": "Ошибка выполнения запроса: " + err.Error()})
+				renderHome(ctx, w, "Ошибка выполнения запроса: "+describeQueryError(ctx, err))
 				return
 			}
 
@@ -403,11 +309,26 @@ func main() {
 			columnName := r.FormValue("columnName")
 			newValue := r.FormValue("newValue")
 
-			err := db.Table(tableName).Where(fmt.Sprintf("%s = ?", keyColumn), keyValue).Update(columnName, newValue).Error
+			var err error
+			// Цена склада меняется через setBookPrice, чтобы изменение попало в историю цен
+			if strings.EqualFold(tableName, "Warehouse") && strings.EqualFold(columnName, "Price") && strings.EqualFold(keyColumn, "BookCode") {
+				bookCode, errCode := strconv.Atoi(keyValue)
+				price, errPrice := decimal.NewFromString(strings.Replace(newValue, ",", ".", 1))
+				if errCode != nil || errPrice != nil {
+					tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "Ошибка: код книги и цена должны быть числами."})
+					return
+				}
+				err = db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+					return setBookPrice(tx, bookCode, price, "ручное изменение")
+				})
+			} else {
+				err = db().WithContext(ctx).Table(tableName).Where(fmt.Sprintf("%s = ?", keyColumn), keyValue).Update(columnName, newValue).Error
+			}
 			if err != nil {
-				tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "Ошибка обновления таблицы: " + err.Error()})
+				tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "Ошибка обновления таблицы: " + describeQueryError(ctx, err)})
 				return
 			}
+			invalidateSearchIndex()
 
 			tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "✅ Изменения сохранены в базе данных!"})
 		}
@@ -425,11 +346,15 @@ func main() {
 			keyColumn := r.FormValue("keyColumn")
 			keyValue := r.FormValue("keyValue")
 
-			err := db.Table(tableName).Where(fmt.Sprintf("%s = ?", keyColumn), keyValue).Delete(nil).Error
+			ctx, cancel := queryContext(r)
+			defer cancel()
+
+			err := db().WithContext(ctx).Table(tableName).Where(fmt.Sprintf("%s = ?", keyColumn), keyValue).Delete(nil).Error
 			if err != nil {
-				tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "Ошибка удаления строки: " + err.Error()})
+				tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "Ошибка удаления строки: " + describeQueryError(ctx, err)})
 				return
 			}
+			invalidateSearchIndex()
 
 			tmpl.ExecuteTemplate(w, "admin_edit.html", map[string]string{"Message": "✅ Строка успешно удалена!"})
 		}
@@ -439,9 +364,12 @@ func main() {
 		if r.Method == http.MethodGet {
 			tableName := r.URL.Query().Get("tableName")
 
-			columns, err := getTableColumns(tableName)
+			ctx, cancel := queryContext(r)
+			defer cancel()
+
+			columns, err := getTableColumns(ctx, tableName)
 			if err != nil {
-				tmpl.ExecuteTemplate(w, "admin_main.html", map[string]string{"Message": "Ошибка получения столбцов таблицы: " + err.Error()})
+				renderHome(ctx, w, "Ошибка получения столбцов таблицы: "+describeQueryError(ctx, err))
 				return
 			}
 
@@ -455,91 +383,38 @@ func main() {
 	})
 	//процедуры
 	http.HandleFunc("/admin_procedures", func(w http.ResponseWriter, r *http.Request) {
-		data := map[string]interface{}{
-			"Message": "Выберите хранимую процедуру для выполнения.",
-		}
-		err := tmpl.ExecuteTemplate(w, "admin_procedures.html", data)
-		if err != nil {
-			http.Error(w, "Ошибка загрузки страницы процедур: "+err.Error(), http.StatusInternalServerError)
-		}
-	})
-	http.HandleFunc("/execute_procedure", func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			tmpl.ExecuteTemplate(w, "admin_procedures.html", map[string]string{"Message": "Ошибка при обработке формы."})
-			return
-		}
-
-		procedureName := r.FormValue("procedureName")
-		inputValue := r.FormValue("inputValue") // Optional input for some procedures
-		var query string
-		var procedureResult []map[string]interface{}
-
-		// Define logic to execute the procedure
-		switch procedureName {
-		case "GetExpensiveStockBooks":
-			query = "EXEC GetExpensiveStockBooks"
-		case "GetOrderDetails":
-			if inputValue == "" {
-				tmpl.ExecuteTemplate(w, "admin_procedures.html", map[string]string{"Message": "Для данной процедуры требуется значение!"})
-				return
-			}
-			query = fmt.Sprintf("EXEC GetOrderDetails @OrderID = %s", inputValue)
-		case "InsertPublishers":
-			query = "EXEC InsertPublishers"
-		case "CalculateAdditionalPayment":
-			if inputValue == "" {
-				tmpl.ExecuteTemplate(w, "admin_procedures.html", map[string]string{"Message": "Для данной процедуры требуется значение!"})
-				return
-			}
-			query = fmt.Sprintf("EXEC CalculateAdditionalPayment @BookCode = %s", inputValue)
-		default:
-			tmpl.ExecuteTemplate(w, "admin_procedures.html", map[string]string{"Message": "Неизвестная процедура."})
-			return
-		}
-
-		// Execute the query
-		rows, err := db.Raw(query).Rows()
-		if err != nil {
-			tmpl.ExecuteTemplate(w, "admin_procedures.html", map[string]string{"Message": "Ошибка выполнения процедуры: " + err.Error()})
-			return
-		}
-		defer rows.Close()
-
-		// Parse the result and handle decimal values
-		columns, _ := rows.Columns()
-		for rows.Next() {
-			values := make([]interface{}, len(columns))
-			valuePtrs := make([]interface{}, len(columns))
-			for i := range values {
-				valuePtrs[i] = &values[i]
-			}
-
-			rows.Scan(valuePtrs...)
-
-			result := make(map[string]interface{})
-			for i, col := range columns {
-				// Handle the AdditionalPayment column separately
-				if col == "AdditionalPayment" {
-					formattedValue, err := ConvertToDecimal(values[i]) // Format decimal value
-					if err == nil {
-						result[col] = formattedValue // Properly formatted decimal value
-					} else {
-						result[col] = values[i] // Fallback for unsupported types
-					}
-				} else {
-					result[col] = values[i] // Default processing for other columns
-				}
-			}
-			procedureResult = append(procedureResult, result)
-		}
-
-		// Render the procedure result
-		data := map[string]interface{}{
-			"Message":         "✅ Процедура выполнена успешно.",
-			"ProcedureResult": procedureResult,
-		}
-		tmpl.ExecuteTemplate(w, "procedure_result.html", data)
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderProcedures(ctx, w, "Выберите хранимую процедуру для выполнения.")
 	})
+	http.HandleFunc("/execute_procedure", handleExecuteProcedure)
+	http.HandleFunc("/export_procedure", handleExportProcedure)
+
+	registerSalesHandlers()
+	registerOrderHandlers()
+	registerStockHandlers()
+	registerReceivingHandlers()
+	registerStocktakeHandlers()
+	registerAuditHandlers()
+	registerCatalogueHandlers()
+	registerSearchHandlers()
+	registerAuthorHandlers()
+	registerClassifierHandlers()
+	registerPerformanceHandlers()
+	registerCommissionHandlers()
+	registerAnalyticsHandlers()
+	registerValuationHandlers()
+	registerPricingHandlers()
+	registerPublisherHandlers()
+	registerCustomerHandlers()
+	registerSchedulerHandlers()
+	registerJobHandlers()
+	registerSavedReportHandlers()
+	registerConsoleHandlers()
+
+	go runSnapshotScheduler()
+	go runReportScheduler()
+	startJobWorkers()
 
 	fmt.Println("Сервер запущен на http://localhost:8080")
 	http.ListenAndServe(":8080", nil)
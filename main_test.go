@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestRoleCovers(t *testing.T) {
+	tests := []struct {
+		conn, owner string
+		want        bool
+	}{
+		{"admin", "admin", true},
+		{"admin", "user", true},
+		{"user", "user", true},
+		{"user", "admin", false},
+		{"", "user", false},
+		{"", "", false},
+		{"user", "", false},
+	}
+	for _, tt := range tests {
+		if got := roleCovers(tt.conn, tt.owner); got != tt.want {
+			t.Errorf("roleCovers(%q, %q) = %v, want %v", tt.conn, tt.owner, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Таблицы, которыми владеет само приложение (префикс app_). Модули регистрируют их в init.
+var appModels []interface{}
+
+func registerModels(models ...interface{}) {
+	appModels = append(appModels, models...)
+}
+
+// migrateAppTables создает или обновляет таблицы приложения; требует прав на DDL
+func migrateAppTables(ctx context.Context) error {
+	if len(appModels) == 0 {
+		return nil
+	}
+	if err := db().WithContext(ctx).AutoMigrate(appModels...); err != nil {
+		return fmt.Errorf("Ошибка создания таблиц приложения: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Состояния предварительного заказа
+const (
+	orderNew       = "new"
+	orderReserved  = "reserved"
+	orderReady     = "ready"
+	orderFulfilled = "fulfilled"
+	orderCancelled = "cancelled"
+	// orderLegacy - заказ, оформленный до учета состояний: у него нет строки в app_order_states,
+	// он считается закрытым и в списки открытых заказов не попадает
+	orderLegacy = "legacy"
+)
+
+var orderStatusLabels = map[string]string{
+	orderNew:       "Новый",
+	orderReserved:  "Зарезервирован",
+	orderReady:     "Готов к выдаче",
+	orderFulfilled: "Выполнен",
+	orderCancelled: "Отменен",
+	orderLegacy:    "Архивный",
+}
+
+// orderTransitions - допустимые переходы: действие -> (из состояний, в состояние)
+var orderTransitions = map[string]struct {
+	From []string
+	To   string
+}{
+	"reserve": {From: []string{orderNew}, To: orderReserved},
+	"ready":   {From: []string{orderReserved}, To: orderReady},
+	"fulfil":  {From: []string{orderReady}, To: orderFulfilled},
+	"cancel":  {From: []string{orderNew, orderReserved, orderReady}, To: orderCancelled},
+}
+
+// orderState - состояние заказа из Orders, хранится отдельно от исходной таблицы
+type orderState struct {
+	OrderID    int    `gorm:"primaryKey;autoIncrement:false"`
+	Status     string `gorm:"size:20;index"`
+	EmployeeID *int   // сотрудник, выдавший заказ
+	UpdatedAt  time.Time
+}
+
+func (orderState) TableName() string { return "app_order_states" }
+
+// orderLine - книга в заказе
+type orderLine struct {
+	ID       uint `gorm:"primaryKey"`
+	OrderID  int  `gorm:"index"`
+	BookCode int
+	Quantity int
+}
+
+func (orderLine) TableName() string { return "app_order_lines" }
+
+// orderSale - строка Sales, добавленная при выдаче заказа. В Sales нет ссылки на заказ,
+// поэтому продажа записывается с теми же значениями, что ушли в Sales, и ценой на момент выдачи.
+type orderSale struct {
+	ID         uint `gorm:"primaryKey"`
+	OrderID    int  `gorm:"index"`
+	BookCode   int
+	EmployeeID int
+	SaleDate   time.Time
+	Quantity   int
+	Price      decimal.Decimal `gorm:"type:decimal(18,2)"`
+}
+
+func (orderSale) TableName() string { return "app_order_sales" }
+
+func init() {
+	registerModels(&orderState{}, &orderLine{}, &orderSale{})
+}
+
+// orderSummary - заказ со статусом и возрастом для списков
+type orderSummary struct {
+	OrderID      int
+	CustomerInfo string
+	OrderDate    time.Time
+	Status       string
+	CustomerID   int // карточка заказчика, 0 - заказ еще не привязан
+}
+
+// StatusLabel возвращает название состояния на русском
+func (o orderSummary) StatusLabel() string {
+	return orderStatusLabels[o.Status]
+}
+
+// AgeDays - сколько дней прошло с момента оформления заказа
+func (o orderSummary) AgeDays() int {
+	if o.OrderDate.IsZero() {
+		return 0
+	}
+	return int(time.Since(o.OrderDate).Hours() / 24)
+}
+
+// AgeBucket группирует заказы по возрасту для подсветки просроченных
+func (o orderSummary) AgeBucket() string {
+	switch days := o.AgeDays(); {
+	case days <= 7:
+		return "до недели"
+	case days <= 30:
+		return "до месяца"
+	default:
+		return "более месяца"
+	}
+}
+
+// customerOrders - открытые заказы одного заказчика
+type customerOrders struct {
+	CustomerInfo string
+	CustomerID   int
+	Orders       []orderSummary
+	OldestDays   int
+}
+
+const orderSummarySelect = `
+    SELECT o.OrderID, o.CustomerInfo, o.OrderDate, COALESCE(s.status, 'legacy') AS Status,
+           COALESCE(co.customer_id, 0) AS CustomerID
+    FROM Orders o
+    LEFT JOIN app_order_states s ON s.order_id = o.OrderID
+    LEFT JOIN app_customer_orders co ON co.order_id = o.OrderID`
+
+// openOrdersByCustomer возвращает незавершенные заказы, сгруппированные по заказчикам
+func openOrdersByCustomer(ctx context.Context) ([]customerOrders, error) {
+	var orders []orderSummary
+	err := db().WithContext(ctx).Raw(orderSummarySelect+`
+        WHERE s.status IN ?
+        ORDER BY o.CustomerInfo, o.OrderDate`, []string{orderNew, orderReserved, orderReady}).Scan(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	var groups []customerOrders
+	for _, o := range orders {
+		if len(groups) == 0 || groups[len(groups)-1].CustomerInfo != o.CustomerInfo {
+			groups = append(groups, customerOrders{CustomerInfo: o.CustomerInfo, CustomerID: o.CustomerID})
+		}
+		g := &groups[len(groups)-1]
+		g.Orders = append(g.Orders, o)
+		if o.AgeDays() > g.OldestDays {
+			g.OldestDays = o.AgeDays()
+		}
+	}
+	return groups, nil
+}
+
+// loadOrder читает заказ со строками
+func loadOrder(ctx context.Context, orderID int) (*orderSummary, []orderLineView, error) {
+	var order orderSummary
+	err := db().WithContext(ctx).Raw(orderSummarySelect+" WHERE o.OrderID = ?", orderID).Scan(&order).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.OrderID == 0 {
+		return nil, nil, fmt.Errorf("заказ %d не найден", orderID)
+	}
+	var lines []orderLineView
+	err = db().WithContext(ctx).Raw(`
+        SELECT l.id AS LineID, l.book_code AS BookCode, b.Name AS Title, l.quantity AS Quantity,
+               COALESCE(w.NumberOfCopies, 0) AS InStock
+        FROM app_order_lines l
+        JOIN Books b ON b.BookCode = l.book_code
+        LEFT JOIN Warehouse w ON w.BookCode = l.book_code
+        WHERE l.order_id = ?
+        ORDER BY l.id`, orderID).Scan(&lines).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return &order, lines, nil
+}
+
+// orderLineView - строка заказа с названием книги и остатком
+type orderLineView struct {
+	LineID   int
+	BookCode int
+	Title    string
+	Quantity int
+	InStock  int
+}
+
+// transitionOrder переводит заказ в новое состояние в одной транзакции со складскими операциями
+func transitionOrder(ctx context.Context, orderID int, action string, employeeID int) error {
+	tr, ok := orderTransitions[action]
+	if !ok {
+		return fmt.Errorf("неизвестное действие %q", action)
+	}
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var exists int64
+		if err := tx.Table("Orders").Where("OrderID = ?", orderID).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("заказ %d не найден", orderID)
+		}
+		var state orderState
+		err := tx.Where("order_id = ?", orderID).Take(&state).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("заказ оформлен до учета состояний и не может быть изменен")
+		}
+		if err != nil {
+			return err
+		}
+		allowed := false
+		for _, from := range tr.From {
+			allowed = allowed || state.Status == from
+		}
+		if !allowed {
+			return fmt.Errorf("действие недоступно для заказа в состоянии «%s»", orderStatusLabels[state.Status])
+		}
+
+		var lines []orderLine
+		if err := tx.Where("order_id = ?", orderID).Find(&lines).Error; err != nil {
+			return err
+		}
+		if len(lines) == 0 && action != "cancel" {
+			return errors.New("в заказе нет книг")
+		}
+
+		switch action {
+		case "reserve":
+			// Резерв сразу списывает экземпляры со склада, чтобы их нельзя было продать на кассе
+			for _, l := range lines {
+				if _, err := takeStock(tx, l.BookCode, l.Quantity); err != nil {
+					return err
+				}
+			}
+		case "fulfil":
+			if _, err := employeeName(tx, employeeID); err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, l := range lines {
+				book, err := stockBookByCode(tx, l.BookCode)
+				if err != nil {
+					return err
+				}
+				if err := insertSale(tx, book, employeeID, now, l.Quantity, true); err != nil {
+					return err
+				}
+				sale := orderSale{OrderID: orderID, BookCode: l.BookCode, EmployeeID: employeeID, SaleDate: now, Quantity: l.Quantity, Price: book.Price}
+				if err := tx.Create(&sale).Error; err != nil {
+					return err
+				}
+			}
+			state.EmployeeID = &employeeID
+		case "cancel":
+			if state.Status == orderReserved || state.Status == orderReady {
+				for _, l := range lines {
+					if err := returnStock(tx, l.BookCode, l.Quantity); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		res := tx.Model(&orderState{}).
+			Where("order_id = ? AND status = ?", orderID, state.Status).
+			Updates(map[string]interface{}{"status": tr.To, "employee_id": state.EmployeeID, "updated_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("заказ был изменен другим пользователем, обновите страницу")
+		}
+		return nil
+	})
+}
+
+// renderOrders выводит список открытых заказов по заказчикам
+func renderOrders(ctx context.Context, w http.ResponseWriter, message string) {
+	data := map[string]interface{}{"Message": message}
+	if currentRole != "admin" {
+		data["Message"] = "Заказы доступны только администратору."
+	} else if groups, err := openOrdersByCustomer(ctx); err != nil {
+		data["Message"] = "Ошибка получения заказов: " + describeQueryError(ctx, err)
+	} else {
+		data["Customers"] = groups
+	}
+	if err := tmpl.ExecuteTemplate(w, "orders.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderOrder выводит карточку заказа
+func renderOrder(ctx context.Context, w http.ResponseWriter, orderID int, message string) {
+	if currentRole != "admin" {
+		renderOrders(ctx, w, "")
+		return
+	}
+	order, lines, err := loadOrder(ctx, orderID)
+	if err != nil {
+		renderOrders(ctx, w, describeQueryError(ctx, err))
+		return
+	}
+	var employees []struct {
+		EmployeeID int
+		FullName   string
+	}
+	db().WithContext(ctx).Table("Employees").Select("EmployeeID, FullName").Order("FullName").Scan(&employees)
+	var sales []orderSale
+	db().WithContext(ctx).Where("order_id = ?", orderID).Order("id").Find(&sales)
+
+	data := map[string]interface{}{
+		"Message":   message,
+		"Order":     order,
+		"Lines":     lines,
+		"Employees": employees,
+		"Sales":     sales,
+	}
+	tmpl.ExecuteTemplate(w, "order_view.html", data)
+}
+
+func registerOrderHandlers() {
+	http.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderOrders(ctx, w, "Открытые заказы по заказчикам.")
+	})
+
+	http.HandleFunc("/order_view", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		orderID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderOrders(ctx, w, "Некорректный номер заказа.")
+			return
+		}
+		renderOrder(ctx, w, orderID, "")
+	})
+
+	http.HandleFunc("/order_create", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderOrders(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		info := strings.TrimSpace(r.FormValue("customerInfo"))
+		// Заказ из карточки заказчика: строка CustomerInfo собирается из карточки, заказ сразу привязывается
+		var card customer
+		if customerID, _ := strconv.Atoi(r.FormValue("customerID")); customerID != 0 {
+			if err := db().WithContext(ctx).First(&card, customerID).Error; err != nil {
+				renderOrders(ctx, w, "Заказчик не найден.")
+				return
+			}
+			info = card.CustomerInfo()
+		}
+		if info == "" {
+			renderOrders(ctx, w, "Укажите заказчика.")
+			return
+		}
+		var orderID int
+		err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Raw("INSERT INTO Orders (CustomerInfo, OrderDate) OUTPUT INSERTED.OrderID VALUES (?, ?)", info, time.Now()).Scan(&orderID).Error
+			if err != nil {
+				return err
+			}
+			if card.ID != 0 {
+				if err := tx.Create(&customerOrder{OrderID: orderID, CustomerID: card.ID}).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&orderState{OrderID: orderID, Status: orderNew}).Error
+		})
+		if err != nil {
+			renderOrders(ctx, w, "Ошибка создания заказа: "+describeQueryError(ctx, err))
+			return
+		}
+		renderOrder(ctx, w, orderID, "✅ Заказ создан, добавьте книги.")
+	})
+
+	http.HandleFunc("/order_add_line", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderOrders(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		orderID, _ := strconv.Atoi(r.FormValue("orderID"))
+		bookCode, err1 := strconv.Atoi(r.FormValue("bookCode"))
+		quantity, err2 := strconv.Atoi(r.FormValue("quantity"))
+		if err1 != nil || err2 != nil || quantity <= 0 {
+			renderOrder(ctx, w, orderID, "Укажите код книги и положительное количество.")
+			return
+		}
+		order, _, err := loadOrder(ctx, orderID)
+		if err != nil {
+			renderOrders(ctx, w, describeQueryError(ctx, err))
+			return
+		}
+		if order.Status != orderNew {
+			renderOrder(ctx, w, orderID, "Книги можно добавлять только в новый заказ.")
+			return
+		}
+		if _, err := stockBookByCode(db().WithContext(ctx), bookCode); err != nil {
+			renderOrder(ctx, w, orderID, "Ошибка: "+describeQueryError(ctx, err))
+			return
+		}
+		if err := db().WithContext(ctx).Create(&orderLine{OrderID: orderID, BookCode: bookCode, Quantity: quantity}).Error; err != nil {
+			renderOrder(ctx, w, orderID, "Ошибка добавления книги: "+describeQueryError(ctx, err))
+			return
+		}
+		renderOrder(ctx, w, orderID, "✅ Книга добавлена в заказ.")
+	})
+
+	http.HandleFunc("/order_transition", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderOrders(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		orderID, _ := strconv.Atoi(r.FormValue("orderID"))
+		employeeID, _ := strconv.Atoi(r.FormValue("employeeID"))
+		if err := transitionOrder(ctx, orderID, r.FormValue("action"), employeeID); err != nil {
+			renderOrder(ctx, w, orderID, "Ошибка: "+describeQueryError(ctx, err))
+			return
+		}
+		renderOrder(ctx, w, orderID, "✅ Состояние заказа изменено.")
+	})
+}
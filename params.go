@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
+// paramDef описывает типизированный параметр отчета или запроса
+type paramDef struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Type     string `json:"type"` // string, int, decimal, date, letter, bool
+	Column   string `json:"column,omitempty"`
+	Op       string `json:"op,omitempty"` // like, prefix, eq, gte, lte, authorLike
+	Required bool   `json:"required,omitempty"`
+}
+
+// InputType возвращает тип поля формы для параметра
+func (p paramDef) InputType() string {
+	switch p.Type {
+	case "int", "decimal":
+		return "number"
+	case "date":
+		return "date"
+	case "bool":
+		return "checkbox"
+	}
+	return "text"
+}
+
+// MaxLength ограничивает длину поля формы для однобуквенных параметров
+func (p paramDef) MaxLength() int {
+	if p.Type == "letter" {
+		return 1
+	}
+	return 0
+}
+
+// parseParam приводит строковое значение из формы к типу параметра
+func parseParam(p paramDef, raw string) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		if p.Required {
+			return nil, fmt.Errorf("поле обязательно для заполнения")
+		}
+		return nil, nil
+	}
+	switch p.Type {
+	case "", "string":
+		return raw, nil
+	case "int":
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ожидается целое число")
+		}
+		return v, nil
+	case "decimal":
+		v, err := decimal.NewFromString(strings.Replace(raw, ",", ".", 1))
+		if err != nil {
+			return nil, fmt.Errorf("ожидается число")
+		}
+		return v.String(), nil
+	case "letter":
+		first, size := utf8.DecodeRuneInString(raw)
+		if size != len(raw) || !unicode.IsLetter(first) {
+			return nil, fmt.Errorf("ожидается одна буква")
+		}
+		return string(unicode.ToUpper(first)), nil
+	case "bool":
+		switch strings.ToLower(raw) {
+		case "1", "on", "true":
+			return true, nil
+		case "0", "off", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("ожидается да/нет")
+	case "date":
+		v, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("ожидается дата в формате ГГГГ-ММ-ДД")
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("неизвестный тип параметра %q", p.Type)
+}
+
+// parseParams разбирает все параметры из формы, возвращая значения и ошибки по полям
+func parseParams(defs []paramDef, form url.Values) (map[string]interface{}, map[string]string) {
+	values := make(map[string]interface{})
+	fieldErrors := make(map[string]string)
+	for _, p := range defs {
+		v, err := parseParam(p, form.Get(p.Name))
+		if err != nil {
+			fieldErrors[p.Name] = err.Error()
+			continue
+		}
+		if v != nil {
+			values[p.Name] = v
+		}
+	}
+	return values, fieldErrors
+}
+
+// paramCondition строит условие WHERE для параметра с фильтром по столбцу
+func paramCondition(p paramDef, value interface{}) (string, interface{}) {
+	column := quoteIdent(p.Column)
+	switch p.Op {
+	case "like":
+		return column + " LIKE ?", "%" + fmt.Sprint(value) + "%"
+	case "prefix":
+		return column + " LIKE ?", fmt.Sprint(value) + "%"
+	case "authorLike":
+		// Столбец содержит основное имя автора, а искать нужно и по вариантам из AuthorNames
+		return column + ` IN (SELECT a.FullName FROM Authors a
+            JOIN (SELECT AuthorID, FullName FROM Authors UNION SELECT AuthorID, FullName FROM AuthorNames) n ON n.AuthorID = a.AuthorID
+            WHERE n.FullName LIKE ?)`, "%" + fmt.Sprint(value) + "%"
+	case "gte":
+		return column + " >= ?", value
+	case "lte":
+		return column + " <= ?", value
+	}
+	return column + " = ?", value
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pdfFont - шрифт TrueType для встраивания в PDF. Стандартные шрифты PDF не содержат кириллицы,
+// поэтому шрифт встраивается целиком и текст записывается номерами глифов (Identity-H).
+type pdfFont struct {
+	data       []byte
+	unitsPerEm int
+	ascent     int
+	descent    int
+	bbox       [4]int
+	advances   []uint16
+	cmap       []byte // подтаблица cmap формата 4
+}
+
+// loadPDFFont читает из файла TrueType таблицы, нужные для вывода текста
+func loadPDFFont(path string) (*pdfFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePDFFont(data)
+}
+
+// parsePDFFont разбирает файл TrueType; поврежденный файл дает ошибку, а не панику
+func parsePDFFont(data []byte) (*pdfFont, error) {
+	if len(data) < 12 {
+		return nil, errors.New("файл не является шрифтом TrueType")
+	}
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errors.New("поврежден каталог таблиц шрифта")
+		}
+		offset := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if offset+length > len(data) {
+			return nil, errors.New("поврежден каталог таблиц шрифта")
+		}
+		tables[string(data[rec:rec+4])] = data[offset : offset+length]
+	}
+	head, hhea, hmtx, cmap := tables["head"], tables["hhea"], tables["hmtx"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || hmtx == nil || cmap == nil {
+		return nil, errors.New("в шрифте нет таблиц head, hhea, hmtx или cmap")
+	}
+	f := &pdfFont{
+		data:       data,
+		unitsPerEm: int(binary.BigEndian.Uint16(head[18:])),
+		ascent:     int(int16(binary.BigEndian.Uint16(hhea[4:]))),
+		descent:    int(int16(binary.BigEndian.Uint16(hhea[6:]))),
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if len(hmtx) < 4*numMetrics || f.unitsPerEm == 0 {
+		return nil, errors.New("повреждена таблица hmtx")
+	}
+	for i := 0; i < numMetrics; i++ {
+		f.advances = append(f.advances, binary.BigEndian.Uint16(hmtx[4*i:]))
+	}
+	// Нужна юникодная подтаблица формата 4: Windows Unicode BMP (3, 1) или Unicode (0, 3)
+	if len(cmap) < 4 {
+		return nil, errors.New("повреждена таблица cmap")
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(cmap[2:])); i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(cmap) {
+			return nil, errors.New("повреждена таблица cmap")
+		}
+		platform, encoding := binary.BigEndian.Uint16(cmap[rec:]), binary.BigEndian.Uint16(cmap[rec+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[rec+4:]))
+		if (platform == 3 && encoding == 1 || platform == 0 && encoding == 3) && offset+4 <= len(cmap) &&
+			binary.BigEndian.Uint16(cmap[offset:]) == 4 {
+			f.cmap = cmap[offset:]
+			break
+		}
+	}
+	if f.cmap == nil {
+		return nil, errors.New("в шрифте нет юникодной таблицы символов")
+	}
+	return f, nil
+}
+
+// glyph возвращает номер глифа для символа, 0 - символа в шрифте нет
+func (f *pdfFont) glyph(r rune) uint16 {
+	if r > 0xFFFF || len(f.cmap) < 14 {
+		return 0
+	}
+	c := uint16(r)
+	segCount := int(binary.BigEndian.Uint16(f.cmap[6:])) / 2
+	ends := 14
+	starts := ends + 2*segCount + 2
+	deltas := starts + 2*segCount
+	rangeOffsets := deltas + 2*segCount
+	if rangeOffsets+2*segCount > len(f.cmap) {
+		return 0
+	}
+	for i := 0; i < segCount; i++ {
+		if binary.BigEndian.Uint16(f.cmap[ends+2*i:]) < c {
+			continue
+		}
+		start := binary.BigEndian.Uint16(f.cmap[starts+2*i:])
+		if start > c {
+			return 0
+		}
+		delta := binary.BigEndian.Uint16(f.cmap[deltas+2*i:])
+		rangeOffset := int(binary.BigEndian.Uint16(f.cmap[rangeOffsets+2*i:]))
+		if rangeOffset == 0 {
+			return c + delta
+		}
+		addr := rangeOffsets + 2*i + rangeOffset + 2*int(c-start)
+		if addr+2 > len(f.cmap) {
+			return 0
+		}
+		if g := binary.BigEndian.Uint16(f.cmap[addr:]); g != 0 {
+			return g + delta
+		}
+		return 0
+	}
+	return 0
+}
+
+// advance - ширина глифа в тысячных долях кегля
+func (f *pdfFont) advance(g uint16) int {
+	w := f.advances[len(f.advances)-1]
+	if int(g) < len(f.advances) {
+		w = f.advances[g]
+	}
+	return int(w) * 1000 / f.unitsPerEm
+}
+
+// textWidth - ширина строки в пунктах при кегле size
+func (f *pdfFont) textWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		total += f.advance(f.glyph(r))
+	}
+	return float64(total) * size / 1000
+}
+
+// fitText обрезает строку до ширины width, добавляя многоточие
+func (f *pdfFont) fitText(s string, size, width float64) string {
+	if f.textWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && f.textWidth(string(runes)+"…", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// pdfPage - содержимое одной страницы
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+// pdfWriter раскладывает наборы строк по страницам A4 в альбомной ориентации
+type pdfWriter struct {
+	font  *pdfFont
+	used  map[uint16]rune
+	pages []*pdfPage
+	y     float64
+}
+
+const (
+	pdfPageWidth  = 842.0
+	pdfPageHeight = 595.0
+	pdfMargin     = 30.0
+	pdfFontSize   = 8.0
+	pdfLineHeight = 11.0
+)
+
+// text выводит строку в точке (x, y) текущей страницы
+func (p *pdfWriter) text(x, y, size float64, s string) {
+	var hex strings.Builder
+	for _, r := range s {
+		g := p.font.glyph(r)
+		p.used[g] = r
+		fmt.Fprintf(&hex, "%04X", g)
+	}
+	page := p.pages[len(p.pages)-1]
+	fmt.Fprintf(&page.content, "BT /F1 %.1f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, y, hex.String())
+}
+
+// line переводит позицию на следующую строку, начиная новую страницу при необходимости
+func (p *pdfWriter) line(height float64) {
+	p.y -= height
+	if len(p.pages) == 0 || p.y < pdfMargin {
+		p.pages = append(p.pages, &pdfPage{})
+		p.y = pdfPageHeight - pdfMargin - height
+	}
+}
+
+// table выводит набор строк таблицей; ширина столбцов - по самому длинному значению, но не шире страницы
+func (p *pdfWriter) table(rs *resultSet) {
+	if rs.Title != "" {
+		p.line(18)
+		p.text(pdfMargin, p.y, 12, rs.Title)
+	}
+	widths := make([]float64, len(rs.Columns))
+	measure := func(i int, s string) {
+		if w := p.font.textWidth(s, pdfFontSize) + 6; w > widths[i] {
+			widths[i] = w
+		}
+	}
+	for i, c := range rs.Columns {
+		measure(i, c)
+	}
+	for _, row := range rs.Rows {
+		for i, v := range row {
+			if i < len(widths) {
+				measure(i, formatCell(v))
+			}
+		}
+	}
+	total := 0.0
+	for _, w := range widths {
+		total += w
+	}
+	if available := pdfPageWidth - 2*pdfMargin; total > available {
+		for i := range widths {
+			widths[i] *= available / total
+		}
+	}
+	row := func(cells []string) {
+		p.line(pdfLineHeight)
+		x := pdfMargin
+		for i, c := range cells {
+			p.text(x, p.y, pdfFontSize, p.font.fitText(c, pdfFontSize, widths[i]-6))
+			x += widths[i]
+		}
+	}
+	row(rs.Columns)
+	page := p.pages[len(p.pages)-1]
+	fmt.Fprintf(&page.content, "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, p.y-3, pdfPageWidth-pdfMargin, p.y-3)
+	for _, r := range rs.Rows {
+		cells := make([]string, len(rs.Columns))
+		for i, v := range r {
+			if i < len(cells) {
+				cells[i] = formatCell(v)
+			}
+		}
+		if p.y-pdfLineHeight < pdfMargin {
+			row(rs.Columns) // заголовок повторяется на каждой странице
+		}
+		row(cells)
+	}
+	if len(rs.Rows) == 0 {
+		p.line(pdfLineHeight)
+		p.text(pdfMargin, p.y, pdfFontSize, "Нет строк.")
+	}
+	p.line(pdfLineHeight)
+}
+
+// writePDF записывает наборы строк в PDF со встроенным шрифтом
+func writePDF(w io.Writer, font *pdfFont, sets []*resultSet) error {
+	p := &pdfWriter{font: font, used: map[uint16]rune{}}
+	for _, rs := range sets {
+		p.table(rs)
+	}
+	if len(p.pages) == 0 {
+		p.line(0)
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(data)
+		zw.Close()
+		object(fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, z.Len(), z.Bytes()))
+	}
+	scale := func(v int) int { return v * 1000 / font.unitsPerEm }
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1-2: каталог и дерево страниц, 3-7: шрифт, далее по два объекта на страницу
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 8+2*i))
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /EmbeddedFont /Encoding /Identity-H /DescendantFonts [4 0 R] /ToUnicode 7 0 R >>")
+
+	glyphs := make([]int, 0, len(p.used))
+	for g := range p.used {
+		glyphs = append(glyphs, int(g))
+	}
+	sort.Ints(glyphs)
+	var widths, toUnicode strings.Builder
+	for _, g := range glyphs {
+		fmt.Fprintf(&widths, "%d [%d] ", g, font.advance(uint16(g)))
+	}
+	object(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /EmbeddedFont "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+		"/FontDescriptor 5 0 R /DW 500 /W [%s] /CIDToGIDMap /Identity >>", widths.String()))
+	object(fmt.Sprintf("<< /Type /FontDescriptor /FontName /EmbeddedFont /Flags 32 /FontBBox [%d %d %d %d] "+
+		"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 6 0 R >>",
+		scale(font.bbox[0]), scale(font.bbox[1]), scale(font.bbox[2]), scale(font.bbox[3]),
+		scale(font.ascent), scale(font.descent), scale(font.ascent)))
+	stream(fmt.Sprintf("/Length1 %d", len(font.data)), font.data)
+
+	// ToUnicode нужен, чтобы текст из PDF можно было копировать и искать
+	toUnicode.WriteString("/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	for i := 0; i < len(glyphs); i += 100 {
+		chunk := glyphs[i:]
+		if len(chunk) > 100 {
+			chunk = chunk[:100]
+		}
+		fmt.Fprintf(&toUnicode, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&toUnicode, "<%04X> <%04X>\n", g, p.used[uint16(g)])
+		}
+		toUnicode.WriteString("endbfchar\n")
+	}
+	toUnicode.WriteString("endcmap CMapName currentdict /CMap defineresource pop end end")
+	stream("", []byte(toUnicode.String()))
+
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 9+2*i))
+		stream("", page.content.Bytes())
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// cmapSegment - сегмент подтаблицы cmap формата 4
+type cmapSegment struct {
+	start, end, delta, rangeOffset uint16
+}
+
+// testCmap собирает подтаблицу cmap формата 4 из сегментов; glyphs - массив glyphIdArray
+func testCmap(segments []cmapSegment, glyphs []uint16) []byte {
+	segCount := len(segments)
+	var words []uint16
+	words = append(words, 4, 0, 0, uint16(2*segCount), 0, 0, 0)
+	for _, s := range segments {
+		words = append(words, s.end)
+	}
+	words = append(words, 0)
+	for _, s := range segments {
+		words = append(words, s.start)
+	}
+	for _, s := range segments {
+		words = append(words, s.delta)
+	}
+	for _, s := range segments {
+		words = append(words, s.rangeOffset)
+	}
+	words = append(words, glyphs...)
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		binary.BigEndian.PutUint16(data[2*i:], w)
+	}
+	binary.BigEndian.PutUint16(data[2:], uint16(len(data)))
+	return data
+}
+
+func TestPDFFontGlyph(t *testing.T) {
+	delta := func(first uint16, glyph int) uint16 { return uint16(glyph - int(first)) }
+	f := &pdfFont{cmap: testCmap([]cmapSegment{
+		{start: 'A', end: 'C', delta: delta('A', 10)},
+		// через glyphIdArray: смещение от idRangeOffset[1] до начала массива - 2 слова
+		{start: 'а', end: 'в', rangeOffset: 4},
+		{start: 0xFFFF, end: 0xFFFF, delta: 1},
+	}, []uint16{20, 0, 22})}
+
+	tests := []struct {
+		r    rune
+		want uint16
+	}{
+		{'A', 10},
+		{'C', 12},
+		{'@', 0},
+		{'D', 0},
+		{'а', 20},
+		{'б', 0},
+		{'в', 22},
+		{'г', 0},
+		{0x1F600, 0},
+	}
+	for _, tt := range tests {
+		if got := f.glyph(tt.r); got != tt.want {
+			t.Errorf("glyph(%q) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+	if got := (&pdfFont{cmap: []byte{0, 4}}).glyph('A'); got != 0 {
+		t.Errorf("glyph в усеченной таблице = %d, want 0", got)
+	}
+}
+
+func TestPDFFontGlyphTrueType(t *testing.T) {
+	const path = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+	if _, err := os.Stat(path); err != nil {
+		t.Skip("нет шрифта " + path)
+	}
+	f, err := loadPDFFont(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range "AzЖжЁё№" {
+		if f.glyph(r) == 0 {
+			t.Errorf("glyph(%q) = 0, символ есть в шрифте", r)
+		}
+	}
+	if f.glyph('A') == f.glyph('Ж') {
+		t.Error("разные символы получили один глиф")
+	}
+	if g := f.glyph(0x1F600); g != 0 {
+		t.Errorf("glyph вне BMP = %d, want 0", g)
+	}
+}
+
+// testFont собирает файл TrueType из таблиц head, hhea, hmtx и переданной cmap
+func testFont(cmap []byte) []byte {
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[34:], 1)
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint16(head[18:], 1000)
+	tables := []struct {
+		tag  string
+		data []byte
+	}{{"cmap", cmap}, {"head", head}, {"hhea", hhea}, {"hmtx", make([]byte, 4)}}
+	data := make([]byte, 12+16*len(tables))
+	binary.BigEndian.PutUint16(data[4:], uint16(len(tables)))
+	for i, tb := range tables {
+		rec := 12 + 16*i
+		copy(data[rec:], tb.tag)
+		binary.BigEndian.PutUint32(data[rec+8:], uint32(len(data)))
+		binary.BigEndian.PutUint32(data[rec+12:], uint32(len(tb.data)))
+		data = append(data, tb.data...)
+	}
+	return data
+}
+
+// testCmapTable собирает таблицу cmap из одной записи (3, 1) и подтаблицы
+func testCmapTable(subtable []byte) []byte {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint16(data[2:], 1)
+	binary.BigEndian.PutUint16(data[4:], 3)
+	binary.BigEndian.PutUint16(data[6:], 1)
+	binary.BigEndian.PutUint32(data[8:], 12)
+	return append(data, subtable...)
+}
+
+func TestParsePDFFont(t *testing.T) {
+	subtable := testCmap([]cmapSegment{{start: 'A', end: 'A', delta: 1}, {start: 0xFFFF, end: 0xFFFF, delta: 1}}, nil)
+	f, err := parsePDFFont(testFont(testCmapTable(subtable)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.glyph('A'); got != 'A'+1 {
+		t.Errorf("glyph('A') = %d, want %d", got, 'A'+1)
+	}
+
+	// число записей в cmap больше, чем помещается в таблицу
+	manyRecords := testCmapTable(nil)[:12]
+	binary.BigEndian.PutUint16(manyRecords[2:], 100)
+	truncated := []struct {
+		name string
+		data []byte
+	}{
+		{"пустой файл", nil},
+		{"cmap короче заголовка", testFont([]byte{0, 0})},
+		{"запись cmap обрезана", testFont([]byte{0, 0, 0, 1, 0, 3})},
+		{"записей больше, чем в таблице", testFont(manyRecords)},
+		{"подтаблица за пределами cmap", testFont(testCmapTable(nil))},
+	}
+	for _, tt := range truncated {
+		if _, err := parsePDFFont(tt.data); err == nil {
+			t.Errorf("%s: ожидалась ошибка", tt.name)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// dateRange - период отчета, обе даты включаются
+type dateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// parseDateRange читает период из параметров from и to; по умолчанию - последние 30 дней
+func parseDateRange(q url.Values) (dateRange, error) {
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	r := dateRange{From: today.AddDate(0, 0, -29), To: today}
+	var err error
+	if v := q.Get("from"); v != "" {
+		if r.From, err = time.Parse("2006-01-02", v); err != nil {
+			return r, fmt.Errorf("дата начала: ожидается дата в формате ГГГГ-ММ-ДД")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if r.To, err = time.Parse("2006-01-02", v); err != nil {
+			return r, fmt.Errorf("дата окончания: ожидается дата в формате ГГГГ-ММ-ДД")
+		}
+	}
+	if r.To.Before(r.From) {
+		return r, fmt.Errorf("дата окончания раньше даты начала")
+	}
+	return r, nil
+}
+
+// Days - число дней в периоде
+func (r dateRange) Days() int {
+	return int(r.To.Sub(r.From).Hours()/24) + 1
+}
+
+// Previous - период такой же длины, непосредственно предшествующий этому
+func (r dateRange) Previous() dateRange {
+	return dateRange{From: r.From.AddDate(0, 0, -r.Days()), To: r.From.AddDate(0, 0, -1)}
+}
+
+// end - граница для условия SaleDate < end, чтобы учесть продажи последнего дня с любым временем
+func (r dateRange) end() time.Time {
+	return r.To.AddDate(0, 0, 1)
+}
+
+func (r dateRange) FromString() string { return r.From.Format("2006-01-02") }
+func (r dateRange) ToString() string   { return r.To.Format("2006-01-02") }
+
+// employeePerformance - итоги продаж сотрудника за период и за предыдущий период
+type employeePerformance struct {
+	EmployeeID  int
+	FullName    string
+	Sales       int
+	Units       int
+	Revenue     decimal.Decimal
+	PrevUnits   int
+	PrevRevenue decimal.Decimal
+}
+
+// UnitsChange - изменение числа проданных экземпляров относительно предыдущего периода
+func (p employeePerformance) UnitsChange() string {
+	return percentChange(decimal.NewFromInt(int64(p.Units)), decimal.NewFromInt(int64(p.PrevUnits)))
+}
+
+// RevenueChange - изменение выручки относительно предыдущего периода
+func (p employeePerformance) RevenueChange() string {
+	return percentChange(p.Revenue, p.PrevRevenue)
+}
+
+// percentChange форматирует изменение в процентах; без базы для сравнения возвращает прочерк
+func percentChange(current, previous decimal.Decimal) string {
+	if previous.IsZero() {
+		return "—"
+	}
+	change := current.Sub(previous).Div(previous).Mul(decimal.NewFromInt(100))
+	sign := ""
+	if change.IsPositive() {
+		sign = "+"
+	}
+	return sign + change.StringFixed(1) + "%"
+}
+
+// dailySales - продажи за один день
+type dailySales struct {
+	Day     time.Time
+	Units   int
+	Revenue decimal.Decimal
+	Percent int // доля от максимального дня для полосы на графике
+}
+
+// В Sales цена продажи не хранится, поэтому она восстанавливается по истории цен: последняя цена,
+// установленная не позже даты продажи, а для продаж до первой записи в истории - прежняя цена
+// из этой записи. Касса и выдача заказов продают по цене склада, а приложение записывает в историю
+// каждое изменение этой цены, так что получается цена из чека. Без истории - текущая цена склада.
+const salesPriceJoin = `LEFT JOIN Warehouse w ON w.BookCode = s.BookID
+        OUTER APPLY (SELECT COALESCE(
+            (SELECT TOP 1 h.new_price FROM app_price_history h
+             WHERE h.book_code = s.BookID AND h.changed_at <= s.SaleDate ORDER BY h.changed_at DESC),
+            (SELECT TOP 1 h.old_price FROM app_price_history h
+             WHERE h.book_code = s.BookID AND h.changed_at > s.SaleDate ORDER BY h.changed_at),
+            w.Price, 0) AS Price) sp`
+
+// salesRevenueExpr - сумма строки Sales; в запросе нужен salesPriceJoin
+const salesRevenueExpr = "s.Quantity * sp.Price"
+
+// employeeTotals возвращает итоги продаж по сотрудникам за период
+func employeeTotals(ctx context.Context, r dateRange) ([]employeePerformance, error) {
+	var totals []employeePerformance
+	err := db().WithContext(ctx).Raw(`
+        SELECT s.EmployeeID, COALESCE(e.FullName, '') AS FullName, COUNT(*) AS Sales,
+               SUM(s.Quantity) AS Units, SUM(`+salesRevenueExpr+`) AS Revenue
+        FROM Sales s
+        LEFT JOIN Employees e ON e.EmployeeID = s.EmployeeID
+        `+salesPriceJoin+`
+        WHERE s.SaleDate >= ? AND s.SaleDate < ?
+        GROUP BY s.EmployeeID, e.FullName
+        ORDER BY Revenue DESC`, r.From, r.end()).Scan(&totals).Error
+	return totals, err
+}
+
+// employeePerformanceFor сопоставляет итоги периода с предыдущим периодом той же длины
+func employeePerformanceFor(ctx context.Context, r dateRange) ([]employeePerformance, error) {
+	current, err := employeeTotals(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := employeeTotals(ctx, r.Previous())
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]employeePerformance, len(previous))
+	for _, p := range previous {
+		byID[p.EmployeeID] = p
+	}
+	for i := range current {
+		if p, ok := byID[current[i].EmployeeID]; ok {
+			current[i].PrevUnits = p.Units
+			current[i].PrevRevenue = p.Revenue
+			delete(byID, p.EmployeeID)
+		}
+	}
+	// Сотрудники, продававшие только в предыдущем периоде, тоже попадают в сравнение
+	for _, p := range previous {
+		if _, ok := byID[p.EmployeeID]; ok {
+			current = append(current, employeePerformance{
+				EmployeeID: p.EmployeeID, FullName: p.FullName, PrevUnits: p.Units, PrevRevenue: p.Revenue,
+			})
+		}
+	}
+	return current, nil
+}
+
+// salesTrend возвращает продажи по дням периода, включая дни без продаж; employeeID 0 - все сотрудники
+func salesTrend(ctx context.Context, r dateRange, employeeID int) ([]dailySales, error) {
+	query := `
+        SELECT CAST(s.SaleDate AS date) AS Day, SUM(s.Quantity) AS Units, SUM(` + salesRevenueExpr + `) AS Revenue
+        FROM Sales s
+        ` + salesPriceJoin + `
+        WHERE s.SaleDate >= ? AND s.SaleDate < ?`
+	args := []interface{}{r.From, r.end()}
+	if employeeID != 0 {
+		query += " AND s.EmployeeID = ?"
+		args = append(args, employeeID)
+	}
+	query += " GROUP BY CAST(s.SaleDate AS date)"
+	var rows []dailySales
+	if err := db().WithContext(ctx).Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]dailySales, len(rows))
+	for _, row := range rows {
+		byDay[row.Day.Format("2006-01-02")] = row
+	}
+	days := make([]dailySales, 0, r.Days())
+	maxUnits := 0
+	for d := r.From; !d.After(r.To); d = d.AddDate(0, 0, 1) {
+		day := byDay[d.Format("2006-01-02")]
+		day.Day = d
+		if day.Units > maxUnits {
+			maxUnits = day.Units
+		}
+		days = append(days, day)
+	}
+	if maxUnits > 0 {
+		for i := range days {
+			days[i].Percent = days[i].Units * 100 / maxUnits
+		}
+	}
+	return days, nil
+}
+
+// employeeSales возвращает строки Sales сотрудника за период
+func employeeSales(ctx context.Context, r dateRange, employeeID int) (*resultSet, error) {
+	return queryResultSet(ctx, "Продажи сотрудника", `
+        SELECT s.SaleDate AS [Дата], s.BookID AS BookCode, b.Name AS [Название], s.Quantity AS [Кол-во],
+               sp.Price AS [Цена], `+salesRevenueExpr+` AS [Сумма],
+               CASE WHEN s.IsOrder = 1 THEN N'по заказу' ELSE N'' END AS [Тип]
+        FROM Sales s
+        LEFT JOIN Books b ON b.BookCode = s.BookID
+        `+salesPriceJoin+`
+        WHERE s.EmployeeID = ? AND s.SaleDate >= ? AND s.SaleDate < ?
+        ORDER BY s.SaleDate`, employeeID, r.From, r.end())
+}
+
+// renderPerformance выводит показатели сотрудников за период
+func renderPerformance(ctx context.Context, w http.ResponseWriter, r dateRange, employeeID int, message string) {
+	data := map[string]interface{}{
+		"Message":    message,
+		"Range":      r,
+		"Previous":   r.Previous(),
+		"EmployeeID": employeeID,
+	}
+	if currentRole != "admin" {
+		data["Message"] = "Показатели продаж доступны только администратору."
+		if err := tmpl.ExecuteTemplate(w, "performance.html", data); err != nil {
+			http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var messages []string
+	if message != "" {
+		messages = append(messages, message)
+	}
+	performance, err := employeePerformanceFor(ctx, r)
+	if err != nil {
+		messages = append(messages, "Ошибка расчета показателей: "+describeQueryError(ctx, err))
+	}
+	data["Employees"] = performance
+	var total employeePerformance
+	for _, p := range performance {
+		total.Units += p.Units
+		total.Revenue = total.Revenue.Add(p.Revenue)
+		total.PrevUnits += p.PrevUnits
+		total.PrevRevenue = total.PrevRevenue.Add(p.PrevRevenue)
+		if p.EmployeeID == employeeID {
+			data["Employee"] = p
+		}
+	}
+	data["Total"] = total
+
+	if trend, err := salesTrend(ctx, r, employeeID); err != nil {
+		messages = append(messages, "Ошибка расчета динамики: "+describeQueryError(ctx, err))
+	} else {
+		data["Trend"] = trend
+	}
+	if employeeID != 0 {
+		if sales, err := employeeSales(ctx, r, employeeID); err != nil {
+			messages = append(messages, "Ошибка получения продаж: "+describeQueryError(ctx, err))
+		} else {
+			data["Sales"] = sales
+		}
+	}
+	data["Message"] = strings.Join(messages, " ")
+	if err := tmpl.ExecuteTemplate(w, "performance.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerPerformanceHandlers() {
+	http.HandleFunc("/performance", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		period, err := parseDateRange(q)
+		if err != nil {
+			period, _ = parseDateRange(url.Values{})
+			renderPerformance(ctx, w, period, 0, "Ошибка в периоде: "+err.Error())
+			return
+		}
+		employeeID, _ := strconv.Atoi(q.Get("employee"))
+		renderPerformance(ctx, w, period, employeeID, "")
+	})
+}
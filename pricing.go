@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// priceChange - запись истории цены книги на складе
+type priceChange struct {
+	ID        uint             `gorm:"primaryKey"`
+	BookCode  int              `gorm:"index"`
+	OldPrice  *decimal.Decimal `gorm:"type:decimal(18,2)"` // пусто, если книга впервые поступила на склад
+	NewPrice  decimal.Decimal  `gorm:"type:decimal(18,2)"`
+	ChangedAt time.Time
+	ChangedBy string `gorm:"size:100"`
+	Reason    string `gorm:"size:200"`
+}
+
+func (priceChange) TableName() string { return "app_price_history" }
+
+func init() {
+	registerModels(&priceChange{})
+}
+
+// recordPriceChange добавляет запись в историю цен в рамках транзакции tx
+func recordPriceChange(tx *gorm.DB, bookCode int, oldPrice *decimal.Decimal, newPrice decimal.Decimal, reason string) error {
+	return tx.Create(&priceChange{
+		BookCode:  bookCode,
+		OldPrice:  oldPrice,
+		NewPrice:  newPrice,
+		ChangedAt: time.Now(),
+		ChangedBy: currentUser,
+		Reason:    reason,
+	}).Error
+}
+
+// setBookPrice меняет цену книги на складе и записывает изменение в историю; одинаковая цена не пишется
+func setBookPrice(tx *gorm.DB, bookCode int, newPrice decimal.Decimal, reason string) error {
+	var prices []decimal.Decimal
+	if err := tx.Raw("SELECT Price FROM Warehouse WITH (UPDLOCK) WHERE BookCode = ?", bookCode).Scan(&prices).Error; err != nil {
+		return err
+	}
+	if len(prices) == 0 {
+		return fmt.Errorf("книги %d нет на складе", bookCode)
+	}
+	if prices[0].Equal(newPrice) {
+		return nil
+	}
+	if err := tx.Exec("UPDATE Warehouse SET Price = ? WHERE BookCode = ?", newPrice, bookCode).Error; err != nil {
+		return err
+	}
+	return recordPriceChange(tx, bookCode, &prices[0], newPrice, reason)
+}
+
+// priceFilter - отбор книг для массового изменения цен
+type priceFilter struct {
+	PublisherCode  string
+	ClassifierCode string
+	MinPrice       *decimal.Decimal
+	MaxPrice       *decimal.Decimal
+}
+
+// priceAdjustment - изменение цены: на процент или на фиксированную сумму, в том числе отрицательные
+type priceAdjustment struct {
+	Mode   string // percent или fixed
+	Amount decimal.Decimal
+}
+
+// apply возвращает новую цену, округленную до копеек
+func (a priceAdjustment) apply(price decimal.Decimal) decimal.Decimal {
+	if a.Mode == "percent" {
+		return price.Add(price.Mul(a.Amount).Div(decimal.NewFromInt(100))).Round(2)
+	}
+	return price.Add(a.Amount).Round(2)
+}
+
+// Describe - описание изменения для истории и журнала
+func (a priceAdjustment) Describe() string {
+	sign := ""
+	if a.Amount.IsPositive() {
+		sign = "+"
+	}
+	if a.Mode == "percent" {
+		return "массовое изменение " + sign + a.Amount.String() + "%"
+	}
+	return "массовое изменение " + sign + a.Amount.StringFixed(2)
+}
+
+// pricePreview - книга с текущей и новой ценой
+type pricePreview struct {
+	BookCode      int
+	Name          string
+	PublisherName string
+	OldPrice      decimal.Decimal
+	NewPrice      decimal.Decimal
+}
+
+// Invalid - новая цена не положительна, такая строка не будет изменена
+func (p pricePreview) Invalid() bool { return !p.NewPrice.IsPositive() }
+
+// previewPrices отбирает книги по фильтру и рассчитывает новые цены
+func previewPrices(tx *gorm.DB, f priceFilter, adj priceAdjustment) ([]pricePreview, error) {
+	var conditions []string
+	var args []interface{}
+	if f.PublisherCode != "" {
+		conditions = append(conditions, "CAST(b.PublisherCode AS nvarchar(50)) = ?")
+		args = append(args, f.PublisherCode)
+	}
+	if f.ClassifierCode != "" {
+		conditions = append(conditions, "CAST(b.ClassifierCode AS nvarchar(50)) = ?")
+		args = append(args, f.ClassifierCode)
+	}
+	if f.MinPrice != nil {
+		conditions = append(conditions, "w.Price >= ?")
+		args = append(args, *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		conditions = append(conditions, "w.Price <= ?")
+		args = append(args, *f.MaxPrice)
+	}
+	if len(conditions) == 0 {
+		return nil, errors.New("задайте хотя бы одно условие отбора")
+	}
+	var books []pricePreview
+	err := tx.Raw(`
+        SELECT w.BookCode, COALESCE(b.Name, '') AS Name, COALESCE(p.Name, '') AS PublisherName, w.Price AS OldPrice
+        FROM Warehouse w
+        LEFT JOIN Books b ON b.BookCode = w.BookCode
+        LEFT JOIN Publishers p ON p.PublisherCode = b.PublisherCode
+        WHERE `+strings.Join(conditions, " AND ")+`
+        ORDER BY b.Name`, args...).Scan(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range books {
+		books[i].NewPrice = adj.apply(books[i].OldPrice)
+	}
+	return books, nil
+}
+
+// parsePreviewedPrices читает из формы книги предпросмотра: поля book вида «код:прежняя цена»
+func parsePreviewedPrices(form url.Values) (map[int]decimal.Decimal, error) {
+	prices := make(map[int]decimal.Decimal)
+	for _, v := range form["book"] {
+		code, price, ok := strings.Cut(v, ":")
+		bookCode, err1 := strconv.Atoi(code)
+		oldPrice, err2 := decimal.NewFromString(price)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("некорректная строка предпросмотра %q", v)
+		}
+		prices[bookCode] = oldPrice
+	}
+	if len(prices) == 0 {
+		return nil, errors.New("в предпросмотре нет книг для изменения")
+	}
+	return prices, nil
+}
+
+// applyPrices меняет цены только книг из предпросмотра и только если их цена с тех пор не менялась,
+// поэтому повторная отправка формы не применяет изменение второй раз.
+// Возвращает число измененных книг и число пропущенных из-за изменившейся цены.
+func applyPrices(ctx context.Context, previewed map[int]decimal.Decimal, adj priceAdjustment) (int, int, error) {
+	changed, stale := 0, 0
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		reason := adj.Describe()
+		for bookCode, oldPrice := range previewed {
+			newPrice := adj.apply(oldPrice)
+			if !newPrice.IsPositive() || newPrice.Equal(oldPrice) {
+				continue
+			}
+			res := tx.Exec("UPDATE Warehouse SET Price = ? WHERE BookCode = ? AND Price = ?", newPrice, bookCode, oldPrice)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				stale++
+				continue
+			}
+			if err := recordPriceChange(tx, bookCode, &oldPrice, newPrice, reason); err != nil {
+				return err
+			}
+			changed++
+		}
+		if changed == 0 {
+			return errors.New("ни одна цена не изменилась: цены уже изменены, выполните предпросмотр заново")
+		}
+		return writeAudit(tx, "bulk_price", "warehouse", "", fmt.Sprintf("%s, книг: %d", reason, changed))
+	})
+	return changed, stale, err
+}
+
+// priceHistory возвращает историю цены книги от новых изменений к старым
+func priceHistory(ctx context.Context, bookCode int) ([]priceChange, error) {
+	var history []priceChange
+	err := db().WithContext(ctx).Where("book_code = ?", bookCode).Order("changed_at DESC").Find(&history).Error
+	return history, err
+}
+
+// parsePriceForm читает фильтр и изменение цены из формы
+func parsePriceForm(form url.Values) (priceFilter, priceAdjustment, error) {
+	f := priceFilter{PublisherCode: form.Get("publisher"), ClassifierCode: form.Get("classifier")}
+	for _, bound := range []struct {
+		name string
+		dest **decimal.Decimal
+	}{{"minPrice", &f.MinPrice}, {"maxPrice", &f.MaxPrice}} {
+		raw := strings.TrimSpace(strings.Replace(form.Get(bound.name), ",", ".", 1))
+		if raw == "" {
+			continue
+		}
+		v, err := decimal.NewFromString(raw)
+		if err != nil {
+			return f, priceAdjustment{}, errors.New("границы цены должны быть числами")
+		}
+		*bound.dest = &v
+	}
+	adj := priceAdjustment{Mode: form.Get("mode")}
+	if adj.Mode != "percent" && adj.Mode != "fixed" {
+		return f, adj, errors.New("выберите способ изменения цены")
+	}
+	amount, err := decimal.NewFromString(strings.TrimSpace(strings.Replace(form.Get("amount"), ",", ".", 1)))
+	if err != nil || amount.IsZero() {
+		return f, adj, errors.New("величина изменения должна быть ненулевым числом")
+	}
+	adj.Amount = amount
+	return f, adj, nil
+}
+
+// renderPricing выводит форму массового изменения цен и, если задан, предпросмотр
+func renderPricing(ctx context.Context, w http.ResponseWriter, form url.Values, preview []pricePreview, message string) {
+	data := map[string]interface{}{
+		"Message": message,
+		"Form":    form,
+		"Preview": preview,
+	}
+	var publishers []struct {
+		PublisherCode string
+		Name          string
+	}
+	db().WithContext(ctx).Raw("SELECT CAST(PublisherCode AS nvarchar(50)) AS PublisherCode, Name FROM Publishers ORDER BY Name").Scan(&publishers)
+	var sections []struct {
+		ClassifierCode string
+		Name           string
+	}
+	db().WithContext(ctx).Raw("SELECT CAST(ClassifierCode AS nvarchar(50)) AS ClassifierCode, Name FROM Classifier ORDER BY Name").Scan(&sections)
+	data["Publishers"] = publishers
+	data["Sections"] = sections
+	if err := tmpl.ExecuteTemplate(w, "pricing.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerPricingHandlers() {
+	http.HandleFunc("/pricing", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderPricing(ctx, w, url.Values{"mode": {"percent"}}, nil, "Выберите книги и задайте изменение цены.")
+	})
+
+	http.HandleFunc("/pricing_preview", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderPricing(ctx, w, url.Values{}, nil, "Ошибка при обработке формы.")
+			return
+		}
+		f, adj, err := parsePriceForm(r.Form)
+		if err != nil {
+			renderPricing(ctx, w, r.Form, nil, "Ошибка в параметрах: "+err.Error())
+			return
+		}
+		preview, err := previewPrices(db().WithContext(ctx), f, adj)
+		if err != nil {
+			renderPricing(ctx, w, r.Form, nil, "Ошибка отбора книг: "+describeQueryError(ctx, err))
+			return
+		}
+		if len(preview) == 0 {
+			renderPricing(ctx, w, r.Form, nil, "Под условия не попала ни одна книга.")
+			return
+		}
+		renderPricing(ctx, w, r.Form, preview, fmt.Sprintf("Проверьте новые цены (%s) и подтвердите изменение.", adj.Describe()))
+	})
+
+	http.HandleFunc("/pricing_apply", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderPricing(ctx, w, url.Values{}, nil, "Ошибка при обработке формы.")
+			return
+		}
+		_, adj, err := parsePriceForm(r.Form)
+		if err != nil {
+			renderPricing(ctx, w, r.Form, nil, "Ошибка в параметрах: "+err.Error())
+			return
+		}
+		previewed, err := parsePreviewedPrices(r.Form)
+		if err != nil {
+			renderPricing(ctx, w, r.Form, nil, "Ошибка в параметрах: "+err.Error())
+			return
+		}
+		changed, stale, err := applyPrices(ctx, previewed, adj)
+		if err != nil {
+			renderPricing(ctx, w, r.Form, nil, "Ошибка изменения цен: "+describeQueryError(ctx, err))
+			return
+		}
+		message := "✅ Цены изменены, книг: " + strconv.Itoa(changed) + "."
+		if stale > 0 {
+			message = fmt.Sprintf("Цены изменены, книг: %d. Пропущено книг, цена которых изменилась после предпросмотра: %d.", changed, stale)
+		}
+		renderPricing(ctx, w, url.Values{"mode": {"percent"}}, nil, message)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPriceAdjustmentApply(t *testing.T) {
+	d := decimal.RequireFromString
+	tests := []struct {
+		name    string
+		adj     priceAdjustment
+		price   string
+		want    string
+		invalid bool
+	}{
+		{"процент вверх", priceAdjustment{"percent", d("10")}, "250.00", "275.00", false},
+		{"процент вниз", priceAdjustment{"percent", d("-15")}, "200.00", "170.00", false},
+		{"процент с округлением до копеек", priceAdjustment{"percent", d("7")}, "99.99", "106.99", false},
+		{"половина копейки округляется вверх", priceAdjustment{"percent", d("50")}, "0.05", "0.08", false},
+		{"дробный процент", priceAdjustment{"percent", d("2.5")}, "123.45", "126.54", false},
+		{"процент, обнуляющий цену", priceAdjustment{"percent", d("-100")}, "150.00", "0.00", true},
+		{"процент больше ста вниз", priceAdjustment{"percent", d("-120")}, "100.00", "-20.00", true},
+		{"фиксированная надбавка", priceAdjustment{"fixed", d("15.50")}, "100.00", "115.50", false},
+		{"фиксированная скидка", priceAdjustment{"fixed", d("-30")}, "100.00", "70.00", false},
+		{"фиксированная сумма с долями копейки", priceAdjustment{"fixed", d("0.005")}, "10.00", "10.01", false},
+		{"скидка больше цены", priceAdjustment{"fixed", d("-120")}, "100.00", "-20.00", true},
+	}
+	for _, tt := range tests {
+		got := tt.adj.apply(d(tt.price))
+		if !got.Equal(d(tt.want)) {
+			t.Errorf("%s: apply(%s) = %s, want %s", tt.name, tt.price, got, tt.want)
+		}
+		if p := (pricePreview{NewPrice: got}); p.Invalid() != tt.invalid {
+			t.Errorf("%s: Invalid() = %v, want %v", tt.name, p.Invalid(), tt.invalid)
+		}
+	}
+}
+
+func TestPriceAdjustmentDescribe(t *testing.T) {
+	d := decimal.RequireFromString
+	tests := []struct {
+		adj  priceAdjustment
+		want string
+	}{
+		{priceAdjustment{"percent", d("10")}, "массовое изменение +10%"},
+		{priceAdjustment{"percent", d("-2.5")}, "массовое изменение -2.5%"},
+		{priceAdjustment{"fixed", d("15")}, "массовое изменение +15.00"},
+		{priceAdjustment{"fixed", d("-0.5")}, "массовое изменение -0.50"},
+	}
+	for _, tt := range tests {
+		if got := tt.adj.Describe(); got != tt.want {
+			t.Errorf("Describe(%+v) = %q, want %q", tt.adj, got, tt.want)
+		}
+	}
+}
+
+func TestParsePriceForm(t *testing.T) {
+	tests := []struct {
+		form    url.Values
+		wantErr bool
+	}{
+		{url.Values{"mode": {"percent"}, "amount": {"10"}}, false},
+		{url.Values{"mode": {"fixed"}, "amount": {"-5,50"}, "minPrice": {"100,00"}}, false},
+		{url.Values{"mode": {"percent"}, "amount": {"0"}}, true},
+		{url.Values{"mode": {"percent"}, "amount": {"десять"}}, true},
+		{url.Values{"mode": {"double"}, "amount": {"10"}}, true},
+		{url.Values{"mode": {"fixed"}, "amount": {"10"}, "maxPrice": {"много"}}, true},
+	}
+	for _, tt := range tests {
+		_, _, err := parsePriceForm(tt.form)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePriceForm(%v) error = %v, wantErr %v", tt.form, err, tt.wantErr)
+		}
+	}
+	f, adj, err := parsePriceForm(url.Values{"mode": {"fixed"}, "amount": {"-5,50"}, "minPrice": {"100,00"}})
+	if err != nil || f.MinPrice == nil || !f.MinPrice.Equal(decimal.NewFromInt(100)) || f.MaxPrice != nil ||
+		!adj.Amount.Equal(decimal.RequireFromString("-5.5")) {
+		t.Errorf("parsePriceForm: filter %+v, adjustment %+v, error %v", f, adj, err)
+	}
+}
+
+func TestParsePreviewedPrices(t *testing.T) {
+	got, err := parsePreviewedPrices(url.Values{"book": {"12:100.50", "15:99"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[12].Equal(decimal.RequireFromString("100.5")) || !got[15].Equal(decimal.NewFromInt(99)) {
+		t.Errorf("parsePreviewedPrices = %v", got)
+	}
+	for _, bad := range []url.Values{
+		{},
+		{"book": {"12"}},
+		{"book": {"x:100"}},
+		{"book": {"12:сто"}},
+	} {
+		if _, err := parsePreviewedPrices(bad); err == nil {
+			t.Errorf("parsePreviewedPrices(%v): ожидалась ошибка", bad)
+		}
+	}
+}
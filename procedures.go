@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-sql/sqlexp"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// procParam - параметр хранимой процедуры из sys.parameters
+type procParam struct {
+	paramDef
+	SQLType  string
+	IsOutput bool
+}
+
+// procDef - хранимая процедура, найденная в разрешенной схеме
+type procDef struct {
+	Schema string
+	Name   string
+	Title  string
+	Params []procParam
+}
+
+// FullName возвращает имя процедуры вида schema.name
+func (pd *procDef) FullName() string {
+	return pd.Schema + "." + pd.Name
+}
+
+// procOutput - значение OUTPUT-параметра после выполнения
+type procOutput struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// procedureRun - результат выполнения процедуры: все наборы строк, выходные параметры, код возврата
+// и количество строк, затронутых DML-операторами внутри процедуры
+type procedureRun struct {
+	ID         int    // номер для экспорта
+	User       string // кто выполнял процедуру
+	Procedure  *procDef
+	Results    []*resultSet
+	Outputs    []procOutput
+	ReturnCode int32
+	RowCounts  []int64
+	FinishedAt time.Time
+}
+
+// ResultSets возвращает наборы строк процедуры и набор с итогами: код возврата, OUTPUT-параметры,
+// количество затронутых строк
+func (run *procedureRun) ResultSets() []*resultSet {
+	sets := append([]*resultSet{}, run.Results...)
+	summary := &resultSet{Title: "Итоги выполнения", Columns: []string{"Параметр", "Значение"}, BookColumn: -1}
+	summary.Rows = append(summary.Rows, []interface{}{"Код возврата", run.ReturnCode})
+	for _, out := range run.Outputs {
+		summary.Rows = append(summary.Rows, []interface{}{"@" + out.Name, out.Value})
+	}
+	for i, count := range run.RowCounts {
+		summary.Rows = append(summary.Rows, []interface{}{fmt.Sprintf("Затронуто строк (оператор %d)", i+1), count})
+	}
+	return append(sets, summary)
+}
+
+// procedureRuns - последние результаты выполнения процедур для экспорта, по номеру выполнения
+var (
+	procedureRuns   = map[int]*procedureRun{}
+	procedureRunsMu sync.Mutex
+	lastRunID       int
+)
+
+// maxStoredRuns - сколько последних результатов хранится в памяти
+const maxStoredRuns = 20
+
+// storeProcedureRun сохраняет результат для экспорта и возвращает его номер
+func storeProcedureRun(run *procedureRun) int {
+	procedureRunsMu.Lock()
+	defer procedureRunsMu.Unlock()
+	lastRunID++
+	run.ID, run.User = lastRunID, currentUser
+	procedureRuns[run.ID] = run
+	delete(procedureRuns, run.ID-maxStoredRuns)
+	return run.ID
+}
+
+// findProcedureRun возвращает сохраненный результат, если он получен текущим пользователем
+func findProcedureRun(id int) *procedureRun {
+	procedureRunsMu.Lock()
+	defer procedureRunsMu.Unlock()
+	run := procedureRuns[id]
+	if run == nil || run.User != currentUser {
+		return nil
+	}
+	return run
+}
+
+// paramTypeForSQL сопоставляет тип SQL Server типу поля формы
+func paramTypeForSQL(sqlType string) string {
+	switch strings.ToLower(sqlType) {
+	case "int", "bigint", "smallint", "tinyint":
+		return "int"
+	case "decimal", "numeric", "money", "smallmoney", "float", "real":
+		return "decimal"
+	case "date", "datetime", "datetime2", "smalldatetime":
+		return "date"
+	case "bit":
+		return "bool"
+	}
+	return "string"
+}
+
+// discoverProcedures читает процедуры и их параметры из разрешенных схем
+func discoverProcedures(ctx context.Context) ([]*procDef, error) {
+	var rows []struct {
+		SchemaName  string
+		ProcName    string
+		ParamName   sql.NullString
+		TypeName    sql.NullString
+		IsOutput    sql.NullBool
+		ParameterID sql.NullInt64
+	}
+	err := db().WithContext(ctx).Raw(`
+        SELECT s.name AS schema_name, p.name AS proc_name, prm.name AS param_name,
+               t.name AS type_name, prm.is_output, prm.parameter_id
+        FROM sys.procedures p
+        JOIN sys.schemas s ON s.schema_id = p.schema_id
+        LEFT JOIN sys.parameters prm ON prm.object_id = p.object_id
+        LEFT JOIN sys.types t ON t.user_type_id = prm.user_type_id
+        WHERE s.name IN ? AND p.is_ms_shipped = 0
+        ORDER BY s.name, p.name, prm.parameter_id
+    `, config.ProcedureSchemas).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка получения списка процедур: %s", describeQueryError(ctx, err))
+	}
+
+	var procs []*procDef
+	var current *procDef
+	for _, row := range rows {
+		if current == nil || current.Schema != row.SchemaName || current.Name != row.ProcName {
+			current = &procDef{Schema: row.SchemaName, Name: row.ProcName}
+			current.Title = config.ProcedureTitles[current.FullName()]
+			procs = append(procs, current)
+		}
+		if !row.ParamName.Valid {
+			continue // Процедура без параметров
+		}
+		name := strings.TrimPrefix(row.ParamName.String, "@")
+		label := name
+		if row.IsOutput.Bool {
+			label += " (OUTPUT)"
+		}
+		current.Params = append(current.Params, procParam{
+			paramDef: paramDef{
+				Name:  name,
+				Label: label,
+				Type:  paramTypeForSQL(row.TypeName.String),
+			},
+			SQLType:  row.TypeName.String,
+			IsOutput: row.IsOutput.Bool,
+		})
+	}
+	return procs, nil
+}
+
+// findProcedure ищет процедуру по имени schema.name среди разрешенных
+func findProcedure(ctx context.Context, fullName string) (*procDef, error) {
+	procs, err := discoverProcedures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, pd := range procs {
+		if pd.FullName() == fullName {
+			return pd, nil
+		}
+	}
+	return nil, nil
+}
+
+// outputDest создает приемник OUTPUT-параметра; тип начального значения определяет тип параметра
+func outputDest(p procParam, value interface{}) *interface{} {
+	dest := new(interface{})
+	switch v := value.(type) {
+	case nil:
+		switch p.Type {
+		case "int":
+			*dest = sql.NullInt64{}
+		case "decimal":
+			*dest = sql.NullFloat64{}
+		case "date":
+			*dest = sql.NullTime{}
+		case "bool":
+			*dest = sql.NullBool{}
+		default:
+			*dest = sql.NullString{}
+		}
+	case string:
+		*dest = mssql.NVarCharMax(v) // Без max значение обрезалось бы до длины входной строки
+	default:
+		*dest = v
+	}
+	return dest
+}
+
+// executeProcedure вызывает процедуру с именованными параметрами и читает все наборы строк
+func executeProcedure(ctx context.Context, pd *procDef, values map[string]interface{}) (*procedureRun, error) {
+	sqlDB, err := db().DB()
+	if err != nil {
+		return nil, err
+	}
+
+	var args []interface{}
+	outputs := make(map[string]*interface{})
+	for _, p := range pd.Params {
+		if p.IsOutput {
+			outputs[p.Name] = outputDest(p, values[p.Name])
+			args = append(args, sql.Named(p.Name, sql.Out{Dest: outputs[p.Name], In: values[p.Name] != nil}))
+		} else if value, ok := values[p.Name]; ok {
+			args = append(args, sql.Named(p.Name, value))
+		} // Незаполненные входные параметры не передаются, чтобы сработало значение по умолчанию
+	}
+	var returnStatus mssql.ReturnStatus
+	retmsg := &sqlexp.ReturnMessage{}
+	args = append(args, &returnStatus, retmsg)
+
+	rows, err := sqlDB.QueryContext(ctx, quoteIdent(pd.Schema)+"."+quoteIdent(pd.Name), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &procedureRun{Procedure: pd}
+	titles := config.ProcedureResultTitles[pd.FullName()]
+	var execErr error
+	inResult := false
+	for active := true; active; {
+		switch m := retmsg.Message(ctx).(type) {
+		case sqlexp.MsgNext:
+			result, err := scanResultSet(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if i := len(run.Results); i < len(titles) {
+				result.Title = titles[i]
+			} else {
+				result.Title = fmt.Sprintf("Набор результатов %d", i+1)
+			}
+			run.Results = append(run.Results, result)
+			inResult = true
+		case sqlexp.MsgRowsAffected:
+			// Количество строк после набора результатов относится к SELECT, остальные - к DML
+			if !inResult {
+				run.RowCounts = append(run.RowCounts, m.Count)
+			}
+		case sqlexp.MsgNextResultSet:
+			active = rows.NextResultSet()
+			inResult = false
+		case sqlexp.MsgError:
+			if execErr == nil {
+				execErr = m.Error
+			}
+		}
+	}
+	// Значения OUTPUT-параметров и код возврата доступны только после закрытия rows
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if execErr != nil {
+		return nil, execErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range pd.Params {
+		if p.IsOutput {
+			run.Outputs = append(run.Outputs, procOutput{Name: p.Name, Value: displayValue(*outputs[p.Name])})
+		}
+	}
+	run.ReturnCode = int32(returnStatus)
+	run.FinishedAt = time.Now()
+	return run, nil
+}
+
+// renderProcedures выводит страницу со списком процедур и формой для каждой
+func renderProcedures(ctx context.Context, w http.ResponseWriter, message string) {
+	procs, err := discoverProcedures(ctx)
+	if err != nil {
+		message = err.Error()
+	}
+	data := map[string]interface{}{
+		"Message":    message,
+		"Procedures": procs,
+		"JobFormats": jobFormats,
+	}
+	if err := tmpl.ExecuteTemplate(w, "admin_procedures.html", data); err != nil {
+		http.Error(w, "Ошибка загрузки страницы процедур: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleExecuteProcedure проверяет параметры формы и выполняет процедуру
+func handleExecuteProcedure(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	if err := r.ParseForm(); err != nil {
+		renderProcedures(ctx, w, "Ошибка при обработке формы.")
+		return
+	}
+	if currentRole != "admin" {
+		renderProcedures(ctx, w, "Выполнение процедур доступно только администратору.")
+		return
+	}
+
+	pd, err := findProcedure(ctx, r.FormValue("procedureName"))
+	if err != nil {
+		renderProcedures(ctx, w, err.Error())
+		return
+	}
+	if pd == nil {
+		renderProcedures(ctx, w, "Неизвестная процедура.")
+		return
+	}
+
+	defs := make([]paramDef, len(pd.Params))
+	for i, p := range pd.Params {
+		defs[i] = p.paramDef
+	}
+	values, fieldErrors := parseParams(defs, r.Form)
+	if len(fieldErrors) > 0 {
+		var msgs []string
+		for _, p := range defs {
+			if msg, ok := fieldErrors[p.Name]; ok {
+				msgs = append(msgs, p.Name+": "+msg)
+			}
+		}
+		renderProcedures(ctx, w, "Ошибка в параметрах процедуры. "+strings.Join(msgs, "; "))
+		return
+	}
+
+	run, err := executeProcedure(ctx, pd, values)
+	if err != nil {
+		// Список процедур перечитываем с новым контекстом: текущий мог истечь
+		listCtx, listCancel := context.WithTimeout(context.Background(), statementTimeout("default"))
+		defer listCancel()
+		renderProcedures(listCtx, w, "Ошибка выполнения процедуры: "+describeQueryError(ctx, err))
+		return
+	}
+	storeProcedureRun(run)
+
+	data := map[string]interface{}{
+		"Message": "✅ Процедура выполнена успешно.",
+		"Run":     run,
+	}
+	tmpl.ExecuteTemplate(w, "procedure_result.html", data)
+}
+
+// handleExportProcedure выгружает результат выполнения процедуры с номером run в JSON или CSV
+func handleExportProcedure(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("run"))
+	run := findProcedureRun(id)
+	if run == nil {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderProcedures(ctx, w, "Результат для экспорта не найден или устарел. Выполните процедуру еще раз.")
+		return
+	}
+
+	filename := run.Procedure.Name + "_" + run.FinishedAt.Format("20060102_150405")
+	switch r.URL.Query().Get("format") {
+	case "json":
+		setDownloadHeaders(w, filename+".json", "application/json; charset=utf-8")
+		writeJSON(w, map[string]interface{}{
+			"procedure":   run.Procedure.FullName(),
+			"returnCode":  run.ReturnCode,
+			"outputs":     run.Outputs,
+			"rowCounts":   run.RowCounts,
+			"resultSets":  toJSONResultSets(run.Results),
+			"completedAt": run.FinishedAt,
+		})
+	case "csv":
+		setDownloadHeaders(w, filename+".csv", "text/csv; charset=utf-8")
+		writeCSV(w, run.ResultSets())
+	default:
+		http.Error(w, "Неизвестный формат экспорта", http.StatusBadRequest)
+	}
+}
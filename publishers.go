@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Слова, которые не различают издательства: «ООО Эксмо» и «Издательство Эксмо» - одно издательство
+var publisherNameNoise = map[string]bool{
+	"ооо": true, "оао": true, "зао": true, "пао": true, "ао": true, "ип": true,
+	"изд": true, "издательство": true,
+}
+
+// publisherNameKey - название издательства для поиска дубликатов: без регистра, кавычек и организационной формы
+func publisherNameKey(name string) string {
+	var words []string
+	for _, w := range searchTokens(name) {
+		if !publisherNameNoise[w] {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// validatePublisherName возвращает сообщение об ошибке в названии или пустую строку.
+// Название из одной организационной формы («ООО», «Изд.») не отличить от других при поиске дубликатов.
+func validatePublisherName(name string) string {
+	if name == "" {
+		return "Укажите название издательства."
+	}
+	if publisherNameKey(name) == "" {
+		return "Название издательства не может состоять только из организационной формы."
+	}
+	return ""
+}
+
+// findDuplicatePublisher ищет издательство с таким же названием, кроме exceptCode; возвращает его название
+func findDuplicatePublisher(tx *gorm.DB, name string, exceptCode int) (string, error) {
+	var publishers []struct {
+		PublisherCode int
+		Name          string
+	}
+	if err := tx.Raw("SELECT PublisherCode, Name FROM Publishers").Scan(&publishers).Error; err != nil {
+		return "", err
+	}
+	key := publisherNameKey(name)
+	for _, p := range publishers {
+		if p.PublisherCode != exceptCode && publisherNameKey(p.Name) == key {
+			return p.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// addPublisher добавляет издательство; код 0 - следующий свободный
+func addPublisher(ctx context.Context, code int, name string) (int, error) {
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if code == 0 {
+			if err := tx.Raw("SELECT COALESCE(MAX(PublisherCode), 0) + 1 FROM Publishers WITH (UPDLOCK, HOLDLOCK)").Scan(&code).Error; err != nil {
+				return err
+			}
+		}
+		duplicate, err := findDuplicatePublisher(tx, name, code)
+		if err != nil {
+			return err
+		}
+		if duplicate != "" {
+			return fmt.Errorf("издательство «%s» уже есть", duplicate)
+		}
+		if err := tx.Exec("INSERT INTO Publishers (PublisherCode, Name) VALUES (?, ?)", code, name).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, "create", "publisher", strconv.Itoa(code), name)
+	})
+	return code, err
+}
+
+// renamePublisher меняет название издательства
+func renamePublisher(ctx context.Context, code int, name string) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		duplicate, err := findDuplicatePublisher(tx, name, code)
+		if err != nil {
+			return err
+		}
+		if duplicate != "" {
+			return fmt.Errorf("издательство «%s» уже есть", duplicate)
+		}
+		res := tx.Exec("UPDATE Publishers SET Name = ? WHERE PublisherCode = ?", name, code)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("издательство не найдено")
+		}
+		return writeAudit(tx, "rename", "publisher", strconv.Itoa(code), name)
+	})
+}
+
+// deletePublisher удаляет издательство, если на него не ссылаются книги, продажи и поступления
+func deletePublisher(ctx context.Context, code int) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var refs struct {
+			Books    int
+			Sales    int
+			Receipts int
+		}
+		err := tx.Raw(`
+            SELECT (SELECT COUNT(*) FROM Books WHERE PublisherCode = ?) AS Books,
+                   (SELECT COUNT(*) FROM Sales WHERE PublisherID = ?) AS Sales,
+                   (SELECT COUNT(*) FROM app_goods_receipts WHERE publisher_code = ?) AS Receipts`,
+			code, code, code).Scan(&refs).Error
+		if err != nil {
+			return err
+		}
+		if refs.Books+refs.Sales+refs.Receipts > 0 {
+			return fmt.Errorf("на издательство ссылаются книги (%d), продажи (%d) и поступления (%d)", refs.Books, refs.Sales, refs.Receipts)
+		}
+		var name string
+		if err := tx.Raw("SELECT Name FROM Publishers WHERE PublisherCode = ?", code).Scan(&name).Error; err != nil {
+			return err
+		}
+		res := tx.Exec("DELETE FROM Publishers WHERE PublisherCode = ?", code)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("издательство не найдено")
+		}
+		return writeAudit(tx, "delete", "publisher", strconv.Itoa(code), name)
+	})
+}
+
+// publisherActivity - книги издательства на складе, продажи и поставки за период
+type publisherActivity struct {
+	PublisherCode   int
+	Name            string
+	Titles          int // наименований в каталоге
+	TitlesInStock   int
+	Copies          int // экземпляров на складе
+	TitlesSold      int
+	Units           int
+	Revenue         decimal.Decimal
+	LastSale        *time.Time
+	Deliveries      int // проведенных поступлений
+	DeliveredCopies int
+	LastDelivery    *time.Time
+}
+
+// loadPublisherActivity считает активность издательств за период; code 0 - все издательства.
+// Издательства без продаж и поставок за период тоже попадают в отчет.
+func loadPublisherActivity(ctx context.Context, r dateRange, code int) ([]publisherActivity, error) {
+	query := `
+        SELECT p.PublisherCode, p.Name,
+               COALESCE(bk.Titles, 0) AS Titles, COALESCE(bk.TitlesInStock, 0) AS TitlesInStock, COALESCE(bk.Copies, 0) AS Copies,
+               COALESCE(sa.TitlesSold, 0) AS TitlesSold, COALESCE(sa.Units, 0) AS Units, COALESCE(sa.Revenue, 0) AS Revenue,
+               sa.LastSale,
+               COALESCE(dl.Deliveries, 0) AS Deliveries, COALESCE(dl.DeliveredCopies, 0) AS DeliveredCopies, dl.LastDelivery
+        FROM Publishers p
+        LEFT JOIN (
+            SELECT b.PublisherCode, COUNT(*) AS Titles,
+                   SUM(CASE WHEN w.NumberOfCopies > 0 THEN 1 ELSE 0 END) AS TitlesInStock,
+                   SUM(COALESCE(w.NumberOfCopies, 0)) AS Copies
+            FROM Books b
+            LEFT JOIN Warehouse w ON w.BookCode = b.BookCode
+            GROUP BY b.PublisherCode
+        ) bk ON bk.PublisherCode = p.PublisherCode
+        LEFT JOIN (
+            SELECT s.PublisherID, COUNT(DISTINCT s.BookID) AS TitlesSold, SUM(s.Quantity) AS Units,
+                   SUM(` + salesRevenueExpr + `) AS Revenue, MAX(s.SaleDate) AS LastSale
+            FROM Sales s
+            ` + salesPriceJoin + `
+            WHERE s.SaleDate >= ? AND s.SaleDate < ?
+            GROUP BY s.PublisherID
+        ) sa ON sa.PublisherID = p.PublisherCode
+        LEFT JOIN (
+            SELECT g.publisher_code, COUNT(DISTINCT g.id) AS Deliveries, SUM(l.quantity) AS DeliveredCopies,
+                   MAX(g.delivery_date) AS LastDelivery
+            FROM app_goods_receipts g
+            LEFT JOIN app_goods_receipt_lines l ON l.receipt_id = g.id
+            WHERE g.posted_at IS NOT NULL AND g.delivery_date >= ? AND g.delivery_date < ?
+            GROUP BY g.publisher_code
+        ) dl ON dl.publisher_code = p.PublisherCode`
+	args := []interface{}{r.From, r.end(), r.From, r.end()}
+	if code != 0 {
+		query += " WHERE p.PublisherCode = ?"
+		args = append(args, code)
+	}
+	query += " ORDER BY p.Name"
+	var rows []publisherActivity
+	err := db().WithContext(ctx).Raw(query, args...).Scan(&rows).Error
+	return rows, err
+}
+
+// publisherActivityResultSet готовит отчет об активности издательств для выгрузки
+func publisherActivityResultSet(r dateRange, rows []publisherActivity) *resultSet {
+	rs := &resultSet{
+		Title: "Активность издательств за " + r.FromString() + " — " + r.ToString(),
+		Columns: []string{"Код", "Издательство", "Наименований", "В наличии", "Экземпляров на складе",
+			"Продано наименований", "Продано экз.", "Выручка", "Последняя продажа", "Поставок", "Поставлено экз.", "Последняя поставка"},
+		BookColumn: -1,
+	}
+	date := func(t *time.Time) interface{} {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+	for _, p := range rows {
+		rs.Rows = append(rs.Rows, []interface{}{
+			p.PublisherCode, p.Name, p.Titles, p.TitlesInStock, p.Copies,
+			p.TitlesSold, p.Units, p.Revenue.StringFixed(2), date(p.LastSale), p.Deliveries, p.DeliveredCopies, date(p.LastDelivery),
+		})
+	}
+	return rs
+}
+
+// renderPublishers выводит список издательств с активностью за период
+func renderPublishers(ctx context.Context, w http.ResponseWriter, r dateRange, message string) {
+	data := map[string]interface{}{
+		"Message": message,
+		"Range":   r,
+		"IsAdmin": currentRole == "admin",
+	}
+	// Продажи и поступления видит только администратор, остальным - справочник издательств
+	if currentRole == "admin" {
+		rows, err := loadPublisherActivity(ctx, r, 0)
+		if err != nil {
+			data["Message"] = strings.TrimSpace(message + " Ошибка получения издательств: " + describeQueryError(ctx, err))
+		}
+		data["Publishers"] = rows
+	} else {
+		var rows []publisherActivity
+		err := db().WithContext(ctx).Raw(`
+            SELECT p.PublisherCode, p.Name, COUNT(b.BookCode) AS Titles,
+                   SUM(CASE WHEN w.NumberOfCopies > 0 THEN 1 ELSE 0 END) AS TitlesInStock,
+                   SUM(COALESCE(w.NumberOfCopies, 0)) AS Copies
+            FROM Publishers p
+            LEFT JOIN Books b ON b.PublisherCode = p.PublisherCode
+            LEFT JOIN Warehouse w ON w.BookCode = b.BookCode
+            GROUP BY p.PublisherCode, p.Name
+            ORDER BY p.Name`).Scan(&rows).Error
+		if err != nil {
+			data["Message"] = strings.TrimSpace(message + " Ошибка получения издательств: " + describeQueryError(ctx, err))
+		}
+		data["Publishers"] = rows
+	}
+	if err := tmpl.ExecuteTemplate(w, "publishers.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderPublisher выводит страницу издательства: книги, издания в наличии, продажи и последнюю поставку
+func renderPublisher(ctx context.Context, w http.ResponseWriter, code int, r dateRange, message string) {
+	var publisher struct {
+		PublisherCode int
+		Name          string
+	}
+	err := db().WithContext(ctx).Raw("SELECT PublisherCode, Name FROM Publishers WHERE PublisherCode = ?", code).Scan(&publisher).Error
+	if err != nil || publisher.PublisherCode == 0 {
+		if err != nil {
+			message = "Ошибка получения издательства: " + describeQueryError(ctx, err)
+		} else {
+			message = "Издательство не найдено."
+		}
+		renderPublishers(ctx, w, r, message)
+		return
+	}
+	data := map[string]interface{}{
+		"Publisher": publisher,
+		"Range":     r,
+		"IsAdmin":   currentRole == "admin",
+	}
+
+	var messages []string
+	if message != "" {
+		messages = append(messages, message)
+	}
+	var books []bookCard
+	if err := db().WithContext(ctx).Raw(bookCardSelect+" WHERE b.PublisherCode = ? ORDER BY b.Name", code).Scan(&books).Error; err != nil {
+		messages = append(messages, "Ошибка получения книг: "+describeQueryError(ctx, err))
+	}
+	data["Books"] = books
+	editions, err := queryResultSet(ctx, "Издания в наличии", `
+        SELECT e.*
+        FROM Editions e
+        JOIN Books b ON b.BookCode = e.BookCode
+        JOIN Warehouse w ON w.BookCode = e.BookCode
+        WHERE b.PublisherCode = ? AND w.NumberOfCopies > 0`, code)
+	if err != nil {
+		messages = append(messages, "Ошибка получения изданий: "+describeQueryError(ctx, err))
+	} else {
+		data["Editions"] = editions
+	}
+
+	if currentRole == "admin" {
+		if activity, err := loadPublisherActivity(ctx, r, code); err != nil {
+			messages = append(messages, "Ошибка расчета продаж: "+describeQueryError(ctx, err))
+		} else if len(activity) > 0 {
+			data["Activity"] = activity[0]
+		}
+		// Итоги за все время до конца выбранного периода
+		allTime := dateRange{From: time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), To: r.To}
+		if total, err := loadPublisherActivity(ctx, allTime, code); err == nil && len(total) > 0 {
+			data["Total"] = total[0]
+		}
+		var deliveries []goodsReceiptSummary
+		err := db().WithContext(ctx).Raw(`
+            SELECT TOP 1 g.id AS ID, g.document_no AS DocumentNo, g.delivery_date AS DeliveryDate, g.posted_at AS PostedAt,
+                   COALESCE(SUM(l.quantity), 0) AS Copies,
+                   COALESCE(SUM(l.quantity * l.purchase_price), 0) AS Amount
+            FROM app_goods_receipts g
+            LEFT JOIN app_goods_receipt_lines l ON l.receipt_id = g.id
+            WHERE g.publisher_code = ? AND g.posted_at IS NOT NULL
+            GROUP BY g.id, g.document_no, g.delivery_date, g.posted_at
+            ORDER BY g.delivery_date DESC, g.id DESC`, code).Scan(&deliveries).Error
+		if err != nil {
+			messages = append(messages, "Ошибка получения поставок: "+describeQueryError(ctx, err))
+		} else if len(deliveries) > 0 {
+			data["LastDelivery"] = deliveries[0]
+		}
+	}
+	data["Message"] = strings.Join(messages, " ")
+	if err := tmpl.ExecuteTemplate(w, "publisher_view.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerPublisherHandlers() {
+	http.HandleFunc("/publishers", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		period, err := parseDateRange(q)
+		if err != nil {
+			period, _ = parseDateRange(url.Values{})
+			renderPublishers(ctx, w, period, "Ошибка в периоде: "+err.Error())
+			return
+		}
+		if q.Get("format") != "csv" {
+			renderPublishers(ctx, w, period, "")
+			return
+		}
+		if currentRole != "admin" {
+			renderPublishers(ctx, w, period, "Отчет об активности издательств доступен только администратору.")
+			return
+		}
+		rows, err := loadPublisherActivity(ctx, period, 0)
+		if err != nil {
+			renderPublishers(ctx, w, period, "Ошибка получения издательств: "+describeQueryError(ctx, err))
+			return
+		}
+		setDownloadHeaders(w, "publishers_"+period.From.Format("20060102")+"_"+period.To.Format("20060102")+".csv", "text/csv; charset=utf-8")
+		writeCSV(w, []*resultSet{publisherActivityResultSet(period, rows)})
+	})
+
+	http.HandleFunc("/publisher", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		code, _ := strconv.Atoi(q.Get("code"))
+		period, err := parseDateRange(q)
+		if err != nil {
+			period, _ = parseDateRange(url.Values{})
+			renderPublisher(ctx, w, code, period, "Ошибка в периоде: "+err.Error())
+			return
+		}
+		renderPublisher(ctx, w, code, period, "")
+	})
+
+	// добавление, переименование и удаление издательств
+	http.HandleFunc("/publisher_update", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		period, _ := parseDateRange(url.Values{})
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderPublishers(ctx, w, period, "Ошибка при обработке формы.")
+			return
+		}
+		name := strings.TrimSpace(r.FormValue("name"))
+		code := 0
+		if raw := strings.TrimSpace(r.FormValue("code")); raw != "" {
+			var err error
+			if code, err = strconv.Atoi(raw); err != nil || code <= 0 {
+				renderPublishers(ctx, w, period, "Код издательства должен быть положительным числом.")
+				return
+			}
+		}
+
+		switch r.FormValue("action") {
+		case "add":
+			if msg := validatePublisherName(name); msg != "" {
+				renderPublishers(ctx, w, period, msg)
+				return
+			}
+			added, err := addPublisher(ctx, code, name)
+			if err != nil {
+				renderPublishers(ctx, w, period, "Ошибка добавления издательства: "+describeQueryError(ctx, err))
+				return
+			}
+			invalidateSearchIndex()
+			renderPublisher(ctx, w, added, period, "✅ Издательство добавлено.")
+		case "rename":
+			if msg := validatePublisherName(name); msg != "" {
+				renderPublisher(ctx, w, code, period, msg)
+				return
+			}
+			if err := renamePublisher(ctx, code, name); err != nil {
+				renderPublisher(ctx, w, code, period, "Ошибка переименования: "+describeQueryError(ctx, err))
+				return
+			}
+			invalidateSearchIndex()
+			renderPublisher(ctx, w, code, period, "✅ Издательство переименовано.")
+		case "delete":
+			if err := deletePublisher(ctx, code); err != nil {
+				renderPublisher(ctx, w, code, period, "Ошибка удаления: "+describeQueryError(ctx, err))
+				return
+			}
+			renderPublishers(ctx, w, period, "✅ Издательство удалено.")
+		default:
+			renderPublishers(ctx, w, period, "Неизвестное действие.")
+		}
+	})
+}
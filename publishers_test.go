@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestPublisherNameKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Эксмо", "эксмо"},
+		{"ООО «Эксмо»", "эксмо"},
+		{`ЗАО "Издательство Питер"`, "питер"},
+		{"Изд. АСТ", "аст"},
+		{"  Азбука-Аттикус ", "азбука аттикус"},
+		{"Просвещёние", "просвещение"},
+		{"ИП Иванов", "иванов"},
+		{"Ао", ""},
+		{"Альпина Паблишер", "альпина паблишер"},
+	}
+	for _, tt := range tests {
+		if got := publisherNameKey(tt.name); got != tt.want {
+			t.Errorf("publisherNameKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublisherNameKeyDuplicates(t *testing.T) {
+	same := [][2]string{
+		{"Эксмо", "ООО «ЭКСМО»"},
+		{"Питер", "Издательство \"Питер\""},
+		{"Манн, Иванов и Фербер", "МАНН ИВАНОВ И ФЕРБЕР"},
+	}
+	for _, p := range same {
+		if publisherNameKey(p[0]) != publisherNameKey(p[1]) {
+			t.Errorf("%q и %q должны считаться одним издательством", p[0], p[1])
+		}
+	}
+	if publisherNameKey("Азбука") == publisherNameKey("Азбука-Аттикус") {
+		t.Error("Азбука и Азбука-Аттикус - разные издательства")
+	}
+}
+
+func TestValidatePublisherName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"Эксмо", true},
+		{"ООО «Эксмо»", true},
+		{"", false},
+		{"ООО", false},
+		{"Изд.", false},
+		{"ЗАО «Издательство»", false},
+	}
+	for _, tt := range tests {
+		if got := validatePublisherName(tt.name); (got == "") != tt.valid {
+			t.Errorf("validatePublisherName(%q) = %q, valid %v", tt.name, got, tt.valid)
+		}
+	}
+}
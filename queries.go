@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// queryDef - предопределенный запрос из каталога queries.json
+type queryDef struct {
+	ID     string     `json:"id"`
+	Title  string     `json:"title"`
+	SQL    string     `json:"sql"`
+	Params []paramDef `json:"params"`
+	Roles  []string   `json:"roles"`
+}
+
+// AllowedFor проверяет, доступен ли запрос роли
+func (qd *queryDef) AllowedFor(role string) bool {
+	for _, r := range qd.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Args возвращает именованные аргументы запроса
+func (qd *queryDef) Args(values map[string]interface{}) []interface{} {
+	var args []interface{}
+	for _, p := range qd.Params {
+		args = append(args, sql.Named(p.Name, values[p.Name]))
+	}
+	return args
+}
+
+var queryCatalog []*queryDef
+
+func init() {
+	var err error
+	queryCatalog, err = loadQueries("queries.json")
+	if err != nil {
+		panic("Ошибка загрузки каталога запросов: " + err.Error())
+	}
+}
+
+// loadQueries читает каталог запросов и проверяет, что все параметры используются в SQL
+func loadQueries(path string) ([]*queryDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var queries []*queryDef
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, qd := range queries {
+		if qd.ID == "" || seen[qd.ID] {
+			return nil, fmt.Errorf("пустой или повторяющийся id запроса %q", qd.ID)
+		}
+		seen[qd.ID] = true
+		for _, p := range qd.Params {
+			if !identPattern.MatchString(p.Name) {
+				return nil, fmt.Errorf("запрос %s: недопустимое имя параметра %q", qd.ID, p.Name)
+			}
+			if !strings.Contains(qd.SQL, "@"+p.Name) {
+				return nil, fmt.Errorf("запрос %s: параметр @%s не используется в SQL", qd.ID, p.Name)
+			}
+		}
+	}
+	return queries, nil
+}
+
+// findQuery ищет запрос в каталоге по id
+func findQuery(id string) *queryDef {
+	for _, qd := range queryCatalog {
+		if qd.ID == id {
+			return qd
+		}
+	}
+	return nil
+}
+
+// queriesForRole возвращает запросы, доступные роли
+func queriesForRole(role string) []*queryDef {
+	var queries []*queryDef
+	for _, qd := range queryCatalog {
+		if qd.AllowedFor(role) {
+			queries = append(queries, qd)
+		}
+	}
+	return queries
+}
+
+// renderQueries выводит страницу запросов; activeQuery, values и fieldErrors относятся к последней отправленной форме
+func renderQueries(w http.ResponseWriter, message, activeQuery string, values map[string]string, fieldErrors map[string]string) {
+	data := map[string]interface{}{
+		"Message":     message,
+		"Queries":     queriesForRole(currentRole),
+		"ActiveQuery": activeQuery,
+		"Values":      values,
+		"FieldErrors": fieldErrors,
+		"JobFormats":  jobFormats,
+	}
+	if err := tmpl.ExecuteTemplate(w, "queries.html", data); err != nil {
+		http.Error(w, "Ошибка загрузки страницы запросов: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleExecuteQuery проверяет параметры и выполняет запрос из каталога
+func handleExecuteQuery(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderQueries(w, "Ошибка при отправке данных формы.", "", nil, nil)
+		return
+	}
+
+	qd := findQuery(r.FormValue("queryType"))
+	if qd == nil {
+		renderQueries(w, "Неизвестный тип запроса.", "", nil, nil)
+		return
+	}
+	if !qd.AllowedFor(currentRole) {
+		renderQueries(w, "Запрос недоступен для вашей роли.", "", nil, nil)
+		return
+	}
+
+	values, fieldErrors := parseParams(qd.Params, r.Form)
+	if len(fieldErrors) > 0 {
+		entered := make(map[string]string)
+		for _, p := range qd.Params {
+			entered[p.Name] = r.FormValue(p.Name)
+		}
+		renderQueries(w, "Исправьте ошибки в параметрах запроса.", qd.ID, entered, fieldErrors)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := db().WithContext(ctx).Raw(qd.SQL, qd.Args(values)...).Rows()
+	if err != nil {
+		renderQueries(w, "Ошибка выполнения запроса: "+describeQueryError(ctx, err), "", nil, nil)
+		return
+	}
+	defer rows.Close()
+
+	result, err := scanResultSet(rows)
+	if err != nil {
+		renderQueries(w, "Ошибка выполнения запроса: "+describeQueryError(ctx, err), "", nil, nil)
+		return
+	}
+	result.Title = qd.Title
+
+	data := map[string]interface{}{
+		"Message": "✅ Запрос выполнен успешно.",
+		"Result":  result,
+	}
+	tmpl.ExecuteTemplate(w, "query_result.html", data)
+}
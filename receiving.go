@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// goodsReceipt - документ поступления товара от издательства
+type goodsReceipt struct {
+	ID            uint   `gorm:"primaryKey"`
+	PublisherCode int    `gorm:"index"`
+	DocumentNo    string `gorm:"size:100"` // номер накладной издательства
+	DeliveryDate  time.Time
+	CreatedBy     string `gorm:"size:100"`
+	CreatedAt     time.Time
+	PostedBy      string `gorm:"size:100"`
+	PostedAt      *time.Time
+	Lines         []goodsReceiptLine `gorm:"foreignKey:ReceiptID"`
+}
+
+func (goodsReceipt) TableName() string { return "app_goods_receipts" }
+
+// Posted показывает, проведен ли документ
+func (g goodsReceipt) Posted() bool { return g.PostedAt != nil }
+
+// goodsReceiptLine - строка поступления
+type goodsReceiptLine struct {
+	ID            uint `gorm:"primaryKey"`
+	ReceiptID     uint `gorm:"index"`
+	BookCode      int
+	Title         string `gorm:"size:400"`
+	Quantity      int
+	PurchasePrice decimal.Decimal  `gorm:"type:decimal(18,2)"`
+	RetailPrice   *decimal.Decimal `gorm:"type:decimal(18,2)"` // новая цена продажи, если задана
+}
+
+func (goodsReceiptLine) TableName() string { return "app_goods_receipt_lines" }
+
+// Amount - сумма по закупочной цене
+func (l goodsReceiptLine) Amount() decimal.Decimal {
+	return l.PurchasePrice.Mul(decimal.NewFromInt(int64(l.Quantity)))
+}
+
+func init() {
+	registerModels(&goodsReceipt{}, &goodsReceiptLine{})
+}
+
+// goodsReceiptSummary - документ поступления для списка
+type goodsReceiptSummary struct {
+	ID            uint
+	PublisherName string
+	DocumentNo    string
+	DeliveryDate  time.Time
+	PostedAt      *time.Time
+	Copies        int
+	Amount        decimal.Decimal
+}
+
+// postGoodsReceipt проводит документ: увеличивает остатки на складе или создает позиции склада
+func postGoodsReceipt(ctx context.Context, id uint) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc goodsReceipt
+		if err := tx.Preload("Lines").First(&doc, id).Error; err != nil {
+			return err
+		}
+		if doc.Posted() {
+			return errors.New("документ уже проведен")
+		}
+		if len(doc.Lines) == 0 {
+			return errors.New("в документе нет строк")
+		}
+		for _, l := range doc.Lines {
+			res := tx.Exec("UPDATE Warehouse SET NumberOfCopies = NumberOfCopies + ? WHERE BookCode = ?", l.Quantity, l.BookCode)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				if l.RetailPrice == nil {
+					return fmt.Errorf("книги «%s» нет на складе, укажите для нее цену продажи", l.Title)
+				}
+				err := tx.Exec("INSERT INTO Warehouse (BookCode, Price, NumberOfCopies) VALUES (?, ?, ?)", l.BookCode, *l.RetailPrice, l.Quantity).Error
+				if err != nil {
+					return err
+				}
+				if err := recordPriceChange(tx, l.BookCode, nil, *l.RetailPrice, fmt.Sprintf("поступление №%d", id)); err != nil {
+					return err
+				}
+			} else if l.RetailPrice != nil {
+				if err := setBookPrice(tx, l.BookCode, *l.RetailPrice, fmt.Sprintf("поступление №%d", id)); err != nil {
+					return err
+				}
+			}
+		}
+		now := time.Now()
+		res := tx.Model(&goodsReceipt{}).Where("id = ? AND posted_at IS NULL", id).
+			Updates(map[string]interface{}{"posted_at": now, "posted_by": currentUser})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("документ уже проведен")
+		}
+		return nil
+	})
+}
+
+// renderReceivingList выводит журнал документов поступления
+func renderReceivingList(ctx context.Context, w http.ResponseWriter, message string) {
+	var docs []goodsReceiptSummary
+	err := db().WithContext(ctx).Raw(`
+        SELECT g.id AS ID, COALESCE(p.Name, '') AS PublisherName, g.document_no AS DocumentNo,
+               g.delivery_date AS DeliveryDate, g.posted_at AS PostedAt,
+               COALESCE(SUM(l.quantity), 0) AS Copies,
+               COALESCE(SUM(l.quantity * l.purchase_price), 0) AS Amount
+        FROM app_goods_receipts g
+        LEFT JOIN Publishers p ON p.PublisherCode = g.publisher_code
+        LEFT JOIN app_goods_receipt_lines l ON l.receipt_id = g.id
+        GROUP BY g.id, p.Name, g.document_no, g.delivery_date, g.posted_at
+        ORDER BY g.delivery_date DESC, g.id DESC`).Scan(&docs).Error
+	if err != nil {
+		message = "Ошибка получения документов: " + describeQueryError(ctx, err)
+	}
+	var publishers []struct {
+		PublisherCode int
+		Name          string
+	}
+	db().WithContext(ctx).Table("Publishers").Select("PublisherCode, Name").Order("Name").Scan(&publishers)
+
+	data := map[string]interface{}{
+		"Message":    message,
+		"Documents":  docs,
+		"Publishers": publishers,
+		"Today":      time.Now().Format("2006-01-02"),
+	}
+	if err := tmpl.ExecuteTemplate(w, "receiving.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderGoodsReceipt выводит документ поступления
+func renderGoodsReceipt(ctx context.Context, w http.ResponseWriter, id uint, message string) {
+	var doc goodsReceipt
+	if err := db().WithContext(ctx).Preload("Lines").First(&doc, id).Error; err != nil {
+		renderReceivingList(ctx, w, "Документ не найден: "+describeQueryError(ctx, err))
+		return
+	}
+	var publisherName string
+	db().WithContext(ctx).Table("Publishers").Select("Name").Where("PublisherCode = ?", doc.PublisherCode).Scan(&publisherName)
+
+	total := decimal.Zero
+	for _, l := range doc.Lines {
+		total = total.Add(l.Amount())
+	}
+	data := map[string]interface{}{
+		"Message":       message,
+		"Doc":           doc,
+		"PublisherName": publisherName,
+		"Total":         total,
+	}
+	tmpl.ExecuteTemplate(w, "receiving_view.html", data)
+}
+
+func registerReceivingHandlers() {
+	http.HandleFunc("/receiving", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderReceivingList(ctx, w, "Журнал поступлений от издательств.")
+	})
+
+	http.HandleFunc("/receiving_view", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderReceivingList(ctx, w, "Некорректный номер документа.")
+			return
+		}
+		renderGoodsReceipt(ctx, w, uint(id), "")
+	})
+
+	http.HandleFunc("/receiving_create", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderReceivingList(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		publisherCode, err := strconv.Atoi(r.FormValue("publisherCode"))
+		if err != nil {
+			renderReceivingList(ctx, w, "Выберите издательство.")
+			return
+		}
+		deliveryDate, err := time.Parse("2006-01-02", r.FormValue("deliveryDate"))
+		if err != nil {
+			renderReceivingList(ctx, w, "Дата поставки должна быть в формате ГГГГ-ММ-ДД.")
+			return
+		}
+		doc := goodsReceipt{
+			PublisherCode: publisherCode,
+			DocumentNo:    strings.TrimSpace(r.FormValue("documentNo")),
+			DeliveryDate:  deliveryDate,
+			CreatedBy:     currentUser,
+		}
+		if err := db().WithContext(ctx).Create(&doc).Error; err != nil {
+			renderReceivingList(ctx, w, "Ошибка создания документа: "+describeQueryError(ctx, err))
+			return
+		}
+		renderGoodsReceipt(ctx, w, doc.ID, "✅ Документ создан, добавьте полученные книги.")
+	})
+
+	http.HandleFunc("/receiving_add_line", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderReceivingList(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("receiptID"))
+		var doc goodsReceipt
+		if err := db().WithContext(ctx).First(&doc, id).Error; err != nil {
+			renderReceivingList(ctx, w, "Документ не найден: "+describeQueryError(ctx, err))
+			return
+		}
+		if doc.Posted() {
+			renderGoodsReceipt(ctx, w, doc.ID, "Проведенный документ изменять нельзя.")
+			return
+		}
+
+		bookCode, err1 := strconv.Atoi(r.FormValue("bookCode"))
+		quantity, err2 := strconv.Atoi(r.FormValue("quantity"))
+		purchasePrice, err3 := decimal.NewFromString(strings.Replace(r.FormValue("purchasePrice"), ",", ".", 1))
+		if err1 != nil || err2 != nil || err3 != nil || quantity <= 0 || purchasePrice.IsNegative() {
+			renderGoodsReceipt(ctx, w, doc.ID, "Укажите код книги, положительное количество и закупочную цену.")
+			return
+		}
+		line := goodsReceiptLine{ReceiptID: doc.ID, BookCode: bookCode, Quantity: quantity, PurchasePrice: purchasePrice}
+		if raw := strings.TrimSpace(r.FormValue("retailPrice")); raw != "" {
+			retail, err := decimal.NewFromString(strings.Replace(raw, ",", ".", 1))
+			if err != nil || !retail.IsPositive() {
+				renderGoodsReceipt(ctx, w, doc.ID, "Цена продажи должна быть положительным числом.")
+				return
+			}
+			line.RetailPrice = &retail
+		}
+
+		var book struct {
+			Name          string
+			PublisherCode int
+		}
+		db().WithContext(ctx).Table("Books").Select("Name, PublisherCode").Where("BookCode = ?", bookCode).Scan(&book)
+		if book.Name == "" {
+			renderGoodsReceipt(ctx, w, doc.ID, fmt.Sprintf("Книга с кодом %d не найдена.", bookCode))
+			return
+		}
+		if book.PublisherCode != doc.PublisherCode {
+			renderGoodsReceipt(ctx, w, doc.ID, fmt.Sprintf("Книга «%s» издается другим издательством.", book.Name))
+			return
+		}
+		line.Title = book.Name
+		if err := db().WithContext(ctx).Create(&line).Error; err != nil {
+			renderGoodsReceipt(ctx, w, doc.ID, "Ошибка добавления строки: "+describeQueryError(ctx, err))
+			return
+		}
+		renderGoodsReceipt(ctx, w, doc.ID, "✅ Строка добавлена.")
+	})
+
+	http.HandleFunc("/receiving_remove_line", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderReceivingList(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("receiptID"))
+		lineID, _ := strconv.Atoi(r.FormValue("lineID"))
+		// Удаляем строку только у непроведенного документа
+		err := db().WithContext(ctx).
+			Where("id = ? AND receipt_id IN (SELECT id FROM app_goods_receipts WHERE id = ? AND posted_at IS NULL)", lineID, id).
+			Delete(&goodsReceiptLine{}).Error
+		if err != nil {
+			renderGoodsReceipt(ctx, w, uint(id), "Ошибка удаления строки: "+describeQueryError(ctx, err))
+			return
+		}
+		renderGoodsReceipt(ctx, w, uint(id), "Строка удалена.")
+	})
+
+	http.HandleFunc("/receiving_post", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderReceivingList(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("receiptID"))
+		if err := postGoodsReceipt(ctx, uint(id)); err != nil {
+			renderGoodsReceipt(ctx, w, uint(id), "Документ не проведен: "+describeQueryError(ctx, err))
+			return
+		}
+		renderGoodsReceipt(ctx, w, uint(id), "✅ Документ проведен, остатки на складе обновлены.")
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// reportDef - описание отчета из реестра reports.json
+type reportDef struct {
+	ID      string            `json:"id"`
+	Title   string            `json:"title"`
+	View    string            `json:"view"`
+	Params  []paramDef        `json:"params"`
+	Roles   []string          `json:"roles"`
+	Columns map[string]string `json:"columns"`
+}
+
+// AllowedFor проверяет, доступен ли отчет роли
+func (rd *reportDef) AllowedFor(role string) bool {
+	for _, r := range rd.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnLabel возвращает подпись столбца, если она задана в реестре
+func (rd *reportDef) ColumnLabel(column string) string {
+	if label, ok := rd.Columns[column]; ok {
+		return label
+	}
+	return column
+}
+
+// Query строит параметризованный запрос к представлению отчета
+func (rd *reportDef) Query(values map[string]interface{}) (string, []interface{}) {
+	query := "SELECT * FROM " + quoteIdent(rd.View)
+	var conditions []string
+	var args []interface{}
+	for _, p := range rd.Params {
+		value, ok := values[p.Name]
+		if !ok {
+			continue
+		}
+		condition, arg := paramCondition(p, value)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query, args
+}
+
+var reportRegistry []*reportDef
+
+func init() {
+	var err error
+	reportRegistry, err = loadReports("reports.json")
+	if err != nil {
+		panic("Ошибка загрузки реестра отчетов: " + err.Error())
+	}
+}
+
+// loadReports читает и проверяет реестр отчетов
+func loadReports(path string) ([]*reportDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var reports []*reportDef
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, rd := range reports {
+		if rd.ID == "" || seen[rd.ID] {
+			return nil, fmt.Errorf("пустой или повторяющийся id отчета %q", rd.ID)
+		}
+		seen[rd.ID] = true
+		if !identPattern.MatchString(rd.View) {
+			return nil, fmt.Errorf("отчет %s: недопустимое имя представления %q", rd.ID, rd.View)
+		}
+		for _, p := range rd.Params {
+			if !identPattern.MatchString(p.Name) || !identPattern.MatchString(p.Column) {
+				return nil, fmt.Errorf("отчет %s: недопустимый параметр %q", rd.ID, p.Name)
+			}
+		}
+	}
+	return reports, nil
+}
+
+// findReport ищет отчет в реестре по id
+func findReport(id string) *reportDef {
+	for _, rd := range reportRegistry {
+		if rd.ID == id {
+			return rd
+		}
+	}
+	return nil
+}
+
+// reportsForRole возвращает отчеты, доступные роли
+func reportsForRole(role string) []*reportDef {
+	var reports []*reportDef
+	for _, rd := range reportRegistry {
+		if rd.AllowedFor(role) {
+			reports = append(reports, rd)
+		}
+	}
+	return reports
+}
+
+// renderReportList выводит страницу выбора отчетов для текущей роли
+func renderReportList(w http.ResponseWriter, templateName, message string) {
+	data := map[string]interface{}{
+		"Message":    message,
+		"Reports":    reportsForRole(currentRole),
+		"JobFormats": jobFormats,
+	}
+	if err := tmpl.ExecuteTemplate(w, templateName, data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleViewReport выполняет отчет из реестра; listTemplate - страница выбора для сообщений об ошибках
+func handleViewReport(w http.ResponseWriter, r *http.Request, listTemplate string) {
+	if err := r.ParseForm(); err != nil {
+		renderReportList(w, listTemplate, "Ошибка при выборе отчета.")
+		return
+	}
+
+	rd := findReport(r.FormValue("reportType"))
+	if rd == nil {
+		renderReportList(w, listTemplate, "Неизвестный тип отчета.")
+		return
+	}
+	if !rd.AllowedFor(currentRole) {
+		renderReportList(w, listTemplate, "Отчет недоступен для вашей роли.")
+		return
+	}
+
+	values, fieldErrors := parseParams(rd.Params, r.Form)
+	if len(fieldErrors) > 0 {
+		var msgs []string
+		for _, p := range rd.Params {
+			if msg, ok := fieldErrors[p.Name]; ok {
+				msgs = append(msgs, p.Label+": "+msg)
+			}
+		}
+		renderReportList(w, listTemplate, "Ошибка в параметрах отчета. "+strings.Join(msgs, "; "))
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	query, args := rd.Query(values)
+	rows, err := db().WithContext(ctx).Raw(query, args...).Rows()
+	if err != nil {
+		renderReportList(w, listTemplate, "Ошибка получения данных из представления: "+describeQueryError(ctx, err))
+		return
+	}
+	defer rows.Close()
+
+	result, err := scanResultSet(rows)
+	if err != nil {
+		renderReportList(w, listTemplate, "Ошибка получения данных из представления: "+describeQueryError(ctx, err))
+		return
+	}
+	result.Title = rd.Title
+	for i, col := range result.Columns {
+		result.Columns[i] = rd.ColumnLabel(col)
+	}
+
+	data := map[string]interface{}{
+		"Message": "✅ Данные успешно получены.",
+		"Report":  rd,
+		"Result":  result,
+	}
+	tmpl.ExecuteTemplate(w, "report_view.html", data)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// resultSet - набор строк с сохранением порядка столбцов
+type resultSet struct {
+	Title      string
+	Columns    []string
+	Rows       [][]interface{}
+	BookColumn int // индекс столбца с кодом книги для ссылок на карточку, -1 если его нет
+}
+
+// bookColumnIndex ищет столбец с кодом книги
+func bookColumnIndex(columns []string) int {
+	for i, col := range columns {
+		if strings.EqualFold(col, "BookCode") || strings.EqualFold(col, "BookID") {
+			return i
+		}
+	}
+	return -1
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdent экранирует имя объекта базы данных
+func quoteIdent(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// scanResultSet читает текущий набор строк, приводя значения к отображаемому виду
+func scanResultSet(rows *sql.Rows) (*resultSet, error) {
+	rs, _, err := scanResultSetLimit(rows, 0)
+	return rs, err
+}
+
+// scanResultSetLimit читает не больше limit строк текущего набора (0 - без ограничения);
+// truncated сообщает, что строк было больше
+func scanResultSetLimit(rows *sql.Rows, limit int) (rs *resultSet, truncated bool, err error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, false, fmt.Errorf("Ошибка получения столбцов: %w", err)
+	}
+	rs = &resultSet{Columns: columns, BookColumn: bookColumnIndex(columns)}
+	for rows.Next() {
+		if limit > 0 && len(rs.Rows) == limit {
+			return rs, true, nil
+		}
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, false, fmt.Errorf("Ошибка чтения строки: %w", err)
+		}
+		for i := range values {
+			values[i] = displayValue(values[i])
+		}
+		rs.Rows = append(rs.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return rs, false, nil
+}
+
+// displayValue преобразует значения драйвера ([]byte для decimal) в читаемый вид
+func displayValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		if formatted, err := ConvertToDecimal(b); err == nil {
+			return formatted
+		}
+		return string(b)
+	}
+	return value
+}
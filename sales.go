@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// posReceipt - чек продажи, оформленной через кассу
+type posReceipt struct {
+	ID           uint `gorm:"primaryKey"`
+	EmployeeID   int
+	EmployeeName string `gorm:"size:200"`
+	CreatedAt    time.Time
+	Total        decimal.Decimal  `gorm:"type:decimal(18,2)"`
+	Lines        []posReceiptLine `gorm:"foreignKey:ReceiptID"`
+}
+
+func (posReceipt) TableName() string { return "app_receipts" }
+
+// posReceiptLine - строка чека
+type posReceiptLine struct {
+	ID        uint `gorm:"primaryKey"`
+	ReceiptID uint
+	BookCode  int
+	Title     string `gorm:"size:400"`
+	Quantity  int
+	Price     decimal.Decimal `gorm:"type:decimal(18,2)"`
+}
+
+func (posReceiptLine) TableName() string { return "app_receipt_lines" }
+
+// Amount - сумма по строке
+func (l posReceiptLine) Amount() decimal.Decimal {
+	return l.Price.Mul(decimal.NewFromInt(int64(l.Quantity)))
+}
+
+func init() {
+	registerModels(&posReceipt{}, &posReceiptLine{})
+}
+
+// stockBook - книга на складе с ценой и остатком
+type stockBook struct {
+	BookCode       int
+	Name           string
+	PublisherCode  int
+	Price          decimal.Decimal
+	NumberOfCopies int
+}
+
+// Текущая корзина кассы. Приложение работает с одним подключением, как и глобальное подключение db().
+var posCart struct {
+	sync.Mutex
+	Lines []posReceiptLine
+}
+
+// errOversell возвращается, если на складе меньше экземпляров, чем в продаже
+var errOversell = errors.New("недостаточно экземпляров на складе")
+
+// findStockBooks ищет книги на складе по коду (сканер) или части названия
+func findStockBooks(ctx context.Context, search string) ([]stockBook, error) {
+	var books []stockBook
+	q := db().WithContext(ctx).Table("Warehouse w").
+		Select("b.BookCode, b.Name, b.PublisherCode, w.Price, w.NumberOfCopies").
+		Joins("JOIN Books b ON b.BookCode = w.BookCode")
+	if code, err := strconv.Atoi(search); err == nil {
+		q = q.Where("b.BookCode = ?", code)
+	} else {
+		q = q.Where("b.Name LIKE ?", "%"+search+"%")
+	}
+	err := q.Order("b.Name").Limit(50).Scan(&books).Error
+	return books, err
+}
+
+// recordSale в одной транзакции списывает экземпляры со склада, добавляет строки в Sales и сохраняет чек
+func recordSale(ctx context.Context, employeeID int, lines []posReceiptLine) (*posReceipt, error) {
+	receipt := &posReceipt{EmployeeID: employeeID, CreatedAt: time.Now(), Total: decimal.Zero}
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if receipt.EmployeeName, err = employeeName(tx, employeeID); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			book, err := takeStock(tx, line.BookCode, line.Quantity)
+			if err != nil {
+				return err
+			}
+			if err := insertSale(tx, book, employeeID, receipt.CreatedAt, line.Quantity, false); err != nil {
+				return err
+			}
+			line.Price = book.Price
+			line.Title = book.Name
+			receipt.Lines = append(receipt.Lines, line)
+			receipt.Total = receipt.Total.Add(line.Amount())
+		}
+		return tx.Create(receipt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// stockBookByCode читает складскую позицию книги
+func stockBookByCode(tx *gorm.DB, bookCode int) (stockBook, error) {
+	var book stockBook
+	err := tx.Table("Warehouse w").
+		Select("b.BookCode, b.Name, b.PublisherCode, w.Price, w.NumberOfCopies").
+		Joins("JOIN Books b ON b.BookCode = w.BookCode").
+		Where("w.BookCode = ?", bookCode).
+		Scan(&book).Error
+	if err != nil {
+		return book, err
+	}
+	if book.BookCode == 0 {
+		return book, fmt.Errorf("книга %d отсутствует на складе", bookCode)
+	}
+	return book, nil
+}
+
+// takeStock списывает экземпляры книги со склада; возвращает errOversell, если их не хватает
+func takeStock(tx *gorm.DB, bookCode, quantity int) (stockBook, error) {
+	book, err := stockBookByCode(tx, bookCode)
+	if err != nil {
+		return book, err
+	}
+	// Условие по остатку в UPDATE не дает продать больше, чем есть, даже при параллельных продажах
+	res := tx.Exec("UPDATE Warehouse SET NumberOfCopies = NumberOfCopies - ? WHERE BookCode = ? AND NumberOfCopies >= ?",
+		quantity, bookCode, quantity)
+	if res.Error != nil {
+		return book, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return book, fmt.Errorf("%w: «%s» (в наличии %d, требуется %d)", errOversell, book.Name, book.NumberOfCopies, quantity)
+	}
+	return book, nil
+}
+
+// returnStock возвращает экземпляры книги на склад
+func returnStock(tx *gorm.DB, bookCode, quantity int) error {
+	return tx.Exec("UPDATE Warehouse SET NumberOfCopies = NumberOfCopies + ? WHERE BookCode = ?", quantity, bookCode).Error
+}
+
+// insertSale добавляет строку в Sales; isOrder отмечает продажу по предварительному заказу
+func insertSale(tx *gorm.DB, book stockBook, employeeID int, saleDate time.Time, quantity int, isOrder bool) error {
+	return tx.Exec("INSERT INTO Sales (BookID, PublisherID, EmployeeID, SaleDate, Quantity, IsOrder) VALUES (?, ?, ?, ?, ?, ?)",
+		book.BookCode, book.PublisherCode, employeeID, saleDate, quantity, isOrder).Error
+}
+
+// employeeName возвращает ФИО сотрудника или ошибку, если его нет
+func employeeName(tx *gorm.DB, employeeID int) (string, error) {
+	var name string
+	if err := tx.Table("Employees").Select("FullName").Where("EmployeeID = ?", employeeID).Scan(&name).Error; err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("сотрудник %d не найден", employeeID)
+	}
+	return name, nil
+}
+
+// cartTotal считает сумму корзины
+func cartTotal(lines []posReceiptLine) decimal.Decimal {
+	total := decimal.Zero
+	for _, l := range lines {
+		total = total.Add(l.Amount())
+	}
+	return total
+}
+
+// renderPOS выводит страницу кассы с корзиной и результатами поиска
+func renderPOS(ctx context.Context, w http.ResponseWriter, message, search string, found []stockBook) {
+	var employees []struct {
+		EmployeeID int
+		FullName   string
+	}
+	if err := db().WithContext(ctx).Table("Employees").Select("EmployeeID, FullName").Order("FullName").Scan(&employees).Error; err != nil {
+		message = "Ошибка получения списка сотрудников: " + describeQueryError(ctx, err)
+	}
+
+	posCart.Lock()
+	lines := append([]posReceiptLine{}, posCart.Lines...)
+	posCart.Unlock()
+
+	data := map[string]interface{}{
+		"Message":   message,
+		"Employees": employees,
+		"Search":    search,
+		"Found":     found,
+		"Cart":      lines,
+		"Total":     cartTotal(lines),
+	}
+	if err := tmpl.ExecuteTemplate(w, "pos.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerSalesHandlers() {
+	// касса: поиск книг и корзина; ?added=код - сообщение о книге, добавленной сканированием
+	http.HandleFunc("/pos", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if currentRole != "admin" {
+			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Касса доступна только администратору."})
+			return
+		}
+		if code, err := strconv.Atoi(r.URL.Query().Get("added")); err == nil {
+			message := "✅ Книга добавлена в корзину."
+			posCart.Lock()
+			for _, l := range posCart.Lines {
+				if l.BookCode == code {
+					message = "✅ Книга «" + l.Title + "» добавлена в корзину."
+				}
+			}
+			posCart.Unlock()
+			renderPOS(ctx, w, message, "", nil)
+			return
+		}
+		search := strings.TrimSpace(r.URL.Query().Get("search"))
+		if search == "" {
+			renderPOS(ctx, w, "Отсканируйте код книги или введите часть названия.", "", nil)
+			return
+		}
+		found, err := findStockBooks(ctx, search)
+		if err != nil {
+			renderPOS(ctx, w, "Ошибка поиска книг: "+describeQueryError(ctx, err), search, nil)
+			return
+		}
+		renderPOS(ctx, w, fmt.Sprintf("Найдено книг: %d", len(found)), search, found)
+	})
+
+	// сканирование: точное совпадение по коду сразу попадает в корзину, остальное - в поиск.
+	// После добавления - перенаправление, чтобы обновление страницы не добавило книгу еще раз.
+	http.HandleFunc("/pos_scan", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || r.Method != http.MethodPost || currentRole != "admin" {
+			renderPOS(ctx, w, "Ошибка при обработке формы.", "", nil)
+			return
+		}
+		search := strings.TrimSpace(r.FormValue("search"))
+		if _, err := strconv.Atoi(search); err == nil {
+			found, err := findStockBooks(ctx, search)
+			if err != nil {
+				renderPOS(ctx, w, "Ошибка поиска книг: "+describeQueryError(ctx, err), search, nil)
+				return
+			}
+			if len(found) == 1 {
+				addToCart(found[0], 1)
+				http.Redirect(w, r, "/pos?added="+strconv.Itoa(found[0].BookCode), http.StatusSeeOther)
+				return
+			}
+		}
+		http.Redirect(w, r, "/pos?search="+url.QueryEscape(search), http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/pos_add", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderPOS(ctx, w, "Ошибка при обработке формы.", "", nil)
+			return
+		}
+		quantity, err := strconv.Atoi(r.FormValue("quantity"))
+		if err != nil || quantity <= 0 {
+			renderPOS(ctx, w, "Количество должно быть положительным целым числом.", "", nil)
+			return
+		}
+		found, err := findStockBooks(ctx, r.FormValue("bookCode"))
+		if err != nil || len(found) != 1 {
+			renderPOS(ctx, w, "Книга не найдена на складе.", "", nil)
+			return
+		}
+		addToCart(found[0], quantity)
+		renderPOS(ctx, w, "✅ Книга «"+found[0].Name+"» добавлена в корзину.", "", nil)
+	})
+
+	http.HandleFunc("/pos_remove", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderPOS(ctx, w, "Ошибка при обработке формы.", "", nil)
+			return
+		}
+		bookCode, _ := strconv.Atoi(r.FormValue("bookCode"))
+		posCart.Lock()
+		for i, l := range posCart.Lines {
+			if l.BookCode == bookCode {
+				posCart.Lines = append(posCart.Lines[:i], posCart.Lines[i+1:]...)
+				break
+			}
+		}
+		posCart.Unlock()
+		renderPOS(ctx, w, "Строка удалена из корзины.", "", nil)
+	})
+
+	http.HandleFunc("/pos_confirm", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderPOS(ctx, w, "Ошибка при обработке формы.", "", nil)
+			return
+		}
+		employeeID, err := strconv.Atoi(r.FormValue("employeeID"))
+		if err != nil {
+			renderPOS(ctx, w, "Выберите сотрудника.", "", nil)
+			return
+		}
+
+		posCart.Lock()
+		lines := append([]posReceiptLine{}, posCart.Lines...)
+		posCart.Unlock()
+		if len(lines) == 0 {
+			renderPOS(ctx, w, "Корзина пуста.", "", nil)
+			return
+		}
+
+		receipt, err := recordSale(ctx, employeeID, lines)
+		if err != nil {
+			renderPOS(ctx, w, "Продажа не оформлена: "+describeQueryError(ctx, err), "", nil)
+			return
+		}
+		posCart.Lock()
+		posCart.Lines = nil
+		posCart.Unlock()
+
+		http.Redirect(w, r, fmt.Sprintf("/pos_receipt?id=%d", receipt.ID), http.StatusSeeOther)
+	})
+
+	// печатная форма чека
+	http.HandleFunc("/pos_receipt", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if currentRole != "admin" {
+			tmpl.ExecuteTemplate(w, "template.html", map[string]string{"Message": "Касса доступна только администратору."})
+			return
+		}
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderPOS(ctx, w, "Некорректный номер чека.", "", nil)
+			return
+		}
+		var receipt posReceipt
+		err = db().WithContext(ctx).Preload("Lines").First(&receipt, id).Error
+		if err != nil {
+			renderPOS(ctx, w, "Чек не найден: "+describeQueryError(ctx, err), "", nil)
+			return
+		}
+		tmpl.ExecuteTemplate(w, "pos_receipt.html", map[string]interface{}{"Receipt": receipt})
+	})
+}
+
+// addToCart добавляет книгу в корзину или увеличивает количество
+func addToCart(book stockBook, quantity int) {
+	posCart.Lock()
+	defer posCart.Unlock()
+	for i, l := range posCart.Lines {
+		if l.BookCode == book.BookCode {
+			posCart.Lines[i].Quantity += quantity
+			return
+		}
+	}
+	posCart.Lines = append(posCart.Lines, posReceiptLine{BookCode: book.BookCode, Title: book.Name, Quantity: quantity, Price: book.Price})
+}
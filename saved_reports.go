@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// savedReport - отчет или запрос, сохраненный пользователем вместе с параметрами
+type savedReport struct {
+	ID         uint   `gorm:"primaryKey"`
+	Owner      string `gorm:"size:100;index"`
+	Name       string `gorm:"size:200"`
+	Kind       string `gorm:"size:20"` // report или query
+	Target     string `gorm:"size:300"`
+	Params     string `gorm:"size:2000"` // значения параметров в виде строки запроса URL
+	Pinned     bool   // показывать на главной странице владельца
+	SharedRole string `gorm:"size:20"` // роль, которой доступен отчет; пусто - только владельцу
+	CreatedAt  time.Time
+	LastRunAt  *time.Time
+}
+
+func (savedReport) TableName() string { return "app_saved_reports" }
+
+func init() {
+	registerModels(&savedReport{})
+}
+
+// roleLabels - роли, с которыми можно поделиться отчетом
+var roleLabels = map[string]string{
+	"admin": "администраторы",
+	"user":  "пользователи",
+}
+
+// TargetTitle - название отчета или запроса из реестра
+func (s savedReport) TargetTitle() string {
+	switch s.Kind {
+	case "report":
+		if rd := findReport(s.Target); rd != nil {
+			return rd.Title
+		}
+	case "query":
+		if qd := findQuery(s.Target); qd != nil {
+			return qd.Title
+		}
+	}
+	return s.Target + " (удален из реестра)"
+}
+
+// ParamsText - параметры по одному «имя=значение» в строке
+func (s savedReport) ParamsText() string {
+	values, _ := url.ParseQuery(s.Params)
+	return paramsText(values)
+}
+
+// Own - отчет сохранен текущим пользователем
+func (s savedReport) Own() bool { return s.Owner == currentUser }
+
+// SharedLabel - кому доступен отчет
+func (s savedReport) SharedLabel() string {
+	if s.SharedRole == "" {
+		return "только владельцу"
+	}
+	return roleLabels[s.SharedRole]
+}
+
+// pinnedReports возвращает закрепленные отчеты текущего пользователя для главной страницы.
+// Ошибку не возвращает: главная страница открывается и без них, например до создания таблиц.
+func pinnedReports(ctx context.Context) []savedReport {
+	var saved []savedReport
+	db().WithContext(ctx).Where("owner = ? AND pinned = ?", currentUser, true).Order("name").Find(&saved)
+	return saved
+}
+
+// findSavedReport ищет отчет, доступный текущему пользователю: свой или общий для его роли
+func findSavedReport(ctx context.Context, id int) (*savedReport, error) {
+	var s savedReport
+	if err := db().WithContext(ctx).First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	if !s.Own() && (s.SharedRole == "" || s.SharedRole != currentRole) {
+		return nil, errors.New("отчет недоступен")
+	}
+	return &s, nil
+}
+
+// targetRoles - роли, которым доступен отчет или запрос из реестра
+func targetRoles(kind, target string) []string {
+	switch kind {
+	case "report":
+		if rd := findReport(target); rd != nil {
+			return rd.Roles
+		}
+	case "query":
+		if qd := findQuery(target); qd != nil {
+			return qd.Roles
+		}
+	}
+	return nil
+}
+
+// renderSavedReports выводит свои отчеты и отчеты, которыми поделились с ролью пользователя
+func renderSavedReports(ctx context.Context, w http.ResponseWriter, message string) {
+	data := map[string]interface{}{
+		"Message": message,
+		"Roles":   roleLabels,
+	}
+	var saved []savedReport
+	err := db().WithContext(ctx).Where("owner = ? OR shared_role = ?", currentUser, currentRole).
+		Order("name").Find(&saved).Error
+	if err != nil {
+		data["Message"] = strings.TrimSpace(message + " Ошибка получения сохраненных отчетов: " + describeQueryError(ctx, err))
+	}
+	var own, shared []savedReport
+	for _, s := range saved {
+		if s.Own() {
+			own = append(own, s)
+		} else {
+			shared = append(shared, s)
+		}
+	}
+	data["Own"] = own
+	data["Shared"] = shared
+	if err := tmpl.ExecuteTemplate(w, "saved_reports.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// runSavedReport выполняет сохраненный отчет и выводит результат на странице отчета или запроса
+func runSavedReport(ctx context.Context, w http.ResponseWriter, s *savedReport) {
+	if !targetAllowed(s.Kind, s.Target) {
+		renderSavedReports(ctx, w, "Отчет недоступен для вашей роли.")
+		return
+	}
+	params, err := url.ParseQuery(s.Params)
+	if err != nil {
+		renderSavedReports(ctx, w, "Ошибка в сохраненных параметрах: "+err.Error())
+		return
+	}
+	_, sets, err := executeTarget(ctx, s.Kind, s.Target, params)
+	if err != nil {
+		renderSavedReports(ctx, w, "Ошибка выполнения «"+s.Name+"»: "+describeQueryError(ctx, err))
+		return
+	}
+	db().WithContext(ctx).Model(s).Update("last_run_at", time.Now())
+
+	data := map[string]interface{}{
+		"Message": "✅ " + s.Name,
+		"Result":  sets[0],
+	}
+	page := "query_result.html"
+	if s.Kind == "report" {
+		data["Report"] = findReport(s.Target)
+		page = "report_view.html"
+	}
+	if err := tmpl.ExecuteTemplate(w, page, data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerSavedReportHandlers() {
+	http.HandleFunc("/saved_reports", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderSavedReports(ctx, w, "")
+	})
+
+	// сохранение из формы отчета или запроса: savedName и reportType или queryType, остальное - параметры
+	http.HandleFunc("/saved_create", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil {
+			renderSavedReports(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		s := savedReport{Owner: currentUser, Name: strings.TrimSpace(r.FormValue("savedName")), Kind: "report", Target: r.FormValue("reportType")}
+		if s.Target == "" {
+			s.Kind, s.Target = "query", r.FormValue("queryType")
+		}
+		if s.Name == "" {
+			s.Name = s.TargetTitle()
+		}
+		if !targetAllowed(s.Kind, s.Target) {
+			renderSavedReports(ctx, w, "Отчет недоступен для вашей роли.")
+			return
+		}
+		params, _, err := targetFormParams(ctx, s.Kind, s.Target, r.Form)
+		if err != nil {
+			renderSavedReports(ctx, w, "Отчет не сохранен: "+describeQueryError(ctx, err))
+			return
+		}
+		s.Params = params.Encode()
+
+		var duplicates int64
+		db().WithContext(ctx).Model(&savedReport{}).Where("owner = ? AND name = ?", s.Owner, s.Name).Count(&duplicates)
+		if duplicates > 0 {
+			renderSavedReports(ctx, w, "Отчет «"+s.Name+"» уже сохранен, выберите другое название.")
+			return
+		}
+		err = db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&s).Error; err != nil {
+				return err
+			}
+			return writeAudit(tx, "create", "saved_report", strconv.Itoa(int(s.ID)), s.Name+": "+s.Kind+" "+s.Target)
+		})
+		if err != nil {
+			renderSavedReports(ctx, w, "Ошибка сохранения отчета: "+describeQueryError(ctx, err))
+			return
+		}
+		renderSavedReports(ctx, w, "✅ Отчет «"+s.Name+"» сохранен.")
+	})
+
+	// запуск в один клик
+	http.HandleFunc("/saved_run", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		s, err := findSavedReport(ctx, id)
+		if err != nil {
+			renderSavedReports(ctx, w, "Сохраненный отчет не найден.")
+			return
+		}
+		runSavedReport(ctx, w, s)
+	})
+
+	// закрепление на главной, доступ для роли и удаление - только для своих отчетов
+	http.HandleFunc("/saved_update", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil {
+			renderSavedReports(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		s, err := findSavedReport(ctx, id)
+		if err != nil || !s.Own() {
+			renderSavedReports(ctx, w, "Изменять можно только свои отчеты.")
+			return
+		}
+		key := strconv.Itoa(id)
+		switch r.FormValue("action") {
+		case "pin":
+			// Update записывает новое значение и в s, поэтому сообщение выбирается по pinned
+			pinned := !s.Pinned
+			if err := db().WithContext(ctx).Model(s).Update("pinned", pinned).Error; err != nil {
+				renderSavedReports(ctx, w, "Ошибка изменения отчета: "+describeQueryError(ctx, err))
+				return
+			}
+			if pinned {
+				renderSavedReports(ctx, w, "✅ Отчет «"+s.Name+"» закреплен на главной странице.")
+			} else {
+				renderSavedReports(ctx, w, "✅ Отчет «"+s.Name+"» убран с главной страницы.")
+			}
+		case "share":
+			role := r.FormValue("role")
+			if _, ok := roleLabels[role]; role != "" && !ok {
+				renderSavedReports(ctx, w, "Неизвестная роль.")
+				return
+			}
+			if role != "" {
+				allowed := false
+				for _, rr := range targetRoles(s.Kind, s.Target) {
+					allowed = allowed || rr == role
+				}
+				if !allowed {
+					renderSavedReports(ctx, w, fmt.Sprintf("Отчет «%s» недоступен роли «%s».", s.TargetTitle(), roleLabels[role]))
+					return
+				}
+			}
+			err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(s).Update("shared_role", role).Error; err != nil {
+					return err
+				}
+				return writeAudit(tx, "share", "saved_report", key, s.Name+": "+role)
+			})
+			if err != nil {
+				renderSavedReports(ctx, w, "Ошибка изменения доступа: "+describeQueryError(ctx, err))
+				return
+			}
+			renderSavedReports(ctx, w, "✅ Доступ к отчету «"+s.Name+"» изменен.")
+		case "delete":
+			err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Delete(s).Error; err != nil {
+					return err
+				}
+				return writeAudit(tx, "delete", "saved_report", key, s.Name)
+			})
+			if err != nil {
+				renderSavedReports(ctx, w, "Ошибка удаления отчета: "+describeQueryError(ctx, err))
+				return
+			}
+			renderSavedReports(ctx, w, "✅ Отчет «"+s.Name+"» удален.")
+		default:
+			renderSavedReports(ctx, w, "Неизвестное действие.")
+		}
+	})
+}
@@ -0,0 +1,697 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// reportSchedule - запуск отчета, запроса или процедуры по расписанию с фиксированными параметрами
+type reportSchedule struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"size:200"`
+	Kind       string `gorm:"size:20"`   // report, query или procedure
+	Target     string `gorm:"size:300"`  // id отчета или запроса, schema.name процедуры
+	Params     string `gorm:"size:2000"` // значения параметров в виде строки запроса URL
+	Cron       string `gorm:"size:100"`
+	Format     string `gorm:"size:10"` // csv, pdf или html
+	Delivery   string `gorm:"size:10"` // outbox или smtp
+	Recipients string `gorm:"size:1000"`
+	Enabled    bool
+	CreatedBy  string `gorm:"size:100"`
+	CreatedAt  time.Time
+	LastRunAt  *time.Time
+}
+
+func (reportSchedule) TableName() string { return "app_report_schedules" }
+
+// ParamsText - параметры для формы, по одному «имя=значение» в строке
+func (s reportSchedule) ParamsText() string {
+	values, _ := url.ParseQuery(s.Params)
+	return paramsText(values)
+}
+
+// NextRun - ближайший запуск по расписанию
+func (s reportSchedule) NextRun() *time.Time {
+	c, err := parseCron(s.Cron)
+	if err != nil || !s.Enabled {
+		return nil
+	}
+	next := c.Next(time.Now())
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// scheduleRun - один запуск расписания
+type scheduleRun struct {
+	ID         uint `gorm:"primaryKey"`
+	ScheduleID uint `gorm:"index"`
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Status     string `gorm:"size:20"` // running, ok или failed
+	Rows       int
+	Output     string `gorm:"size:500"` // файл в каталоге отправки или адреса получателей
+	Error      string `gorm:"size:2000"`
+}
+
+func (scheduleRun) TableName() string { return "app_report_schedule_runs" }
+
+func init() {
+	registerModels(&reportSchedule{}, &scheduleRun{})
+}
+
+var targetKinds = map[string]string{
+	"report":    "Отчет",
+	"query":     "Запрос",
+	"procedure": "Процедура",
+}
+
+// documentFormats - форматы, в которых можно получить результат по расписанию
+var documentFormats = map[string]string{
+	"csv":  "CSV",
+	"pdf":  "PDF",
+	"html": "HTML",
+}
+
+// paramsText выводит параметры по одному «имя=значение» в строке в порядке имен
+func paramsText(values url.Values) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, name+"="+values.Get(name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseParamsText разбирает параметры, введенные по одному «имя=значение» в строке
+func parseParamsText(text string) (url.Values, error) {
+	values := url.Values{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("строка %q: ожидается имя=значение", line)
+		}
+		values.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return values, nil
+}
+
+// paramErrorsText собирает ошибки параметров в одну строку в порядке описания
+func paramErrorsText(defs []paramDef, fieldErrors map[string]string) string {
+	var msgs []string
+	for _, p := range defs {
+		if msg, ok := fieldErrors[p.Name]; ok {
+			label := p.Label
+			if label == "" {
+				label = p.Name
+			}
+			msgs = append(msgs, label+": "+msg)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// targetParams возвращает описание параметров и название отчета, запроса или процедуры
+func targetParams(ctx context.Context, kind, target string) ([]paramDef, string, error) {
+	switch kind {
+	case "report":
+		if rd := findReport(target); rd != nil {
+			return rd.Params, rd.Title, nil
+		}
+	case "query":
+		if qd := findQuery(target); qd != nil {
+			return qd.Params, qd.Title, nil
+		}
+	case "procedure":
+		pd, err := findProcedure(ctx, target)
+		if err != nil {
+			return nil, "", err
+		}
+		if pd != nil {
+			defs := make([]paramDef, len(pd.Params))
+			for i, p := range pd.Params {
+				defs[i] = p.paramDef
+			}
+			title := pd.Title
+			if title == "" {
+				title = pd.FullName()
+			}
+			return defs, title, nil
+		}
+	default:
+		return nil, "", fmt.Errorf("неизвестный вид %q", kind)
+	}
+	return nil, "", fmt.Errorf("%s %s не найден", strings.ToLower(targetKinds[kind]), target)
+}
+
+// targetFormParams проверяет параметры отчета, запроса или процедуры в форме и возвращает
+// только их, без остальных полей формы, вместе с названием
+func targetFormParams(ctx context.Context, kind, target string, form url.Values) (url.Values, string, error) {
+	defs, title, err := targetParams(ctx, kind, target)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, fieldErrors := parseParams(defs, form); len(fieldErrors) > 0 {
+		return nil, "", errors.New("ошибка в параметрах: " + paramErrorsText(defs, fieldErrors))
+	}
+	params := url.Values{}
+	for _, p := range defs {
+		if v := form.Get(p.Name); v != "" {
+			params.Set(p.Name, v)
+		}
+	}
+	return params, title, nil
+}
+
+// executeTarget выполняет отчет, запрос или процедуру с параметрами из form
+// и возвращает название и наборы строк
+func executeTarget(ctx context.Context, kind, target string, form url.Values) (string, []*resultSet, error) {
+	defs, title, err := targetParams(ctx, kind, target)
+	if err != nil {
+		return "", nil, err
+	}
+	values, fieldErrors := parseParams(defs, form)
+	if len(fieldErrors) > 0 {
+		return "", nil, errors.New("ошибка в параметрах: " + paramErrorsText(defs, fieldErrors))
+	}
+
+	if kind == "procedure" {
+		pd, err := findProcedure(ctx, target)
+		if err != nil {
+			return "", nil, err
+		}
+		run, err := executeProcedure(ctx, pd, values)
+		if err != nil {
+			return "", nil, err
+		}
+		return title, run.ResultSets(), nil
+	}
+
+	var query string
+	var args []interface{}
+	var rd *reportDef
+	if kind == "report" {
+		rd = findReport(target)
+		query, args = rd.Query(values)
+	} else {
+		qd := findQuery(target)
+		query, args = qd.SQL, qd.Args(values)
+	}
+	rows, err := db().WithContext(ctx).Raw(query, args...).Rows()
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	result, err := scanResultSet(rows)
+	if err != nil {
+		return "", nil, err
+	}
+	result.Title = title
+	if rd != nil {
+		for i, col := range result.Columns {
+			result.Columns[i] = rd.ColumnLabel(col)
+		}
+	}
+	return title, []*resultSet{result}, nil
+}
+
+// renderDocument готовит файл с наборами строк в заданном формате; возвращает содержимое,
+// расширение и тип содержимого
+func renderDocument(format, title string, sets []*resultSet) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		if err := writeCSV(&buf, sets); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), ".csv", "text/csv; charset=utf-8", nil
+	case "html":
+		data := map[string]interface{}{"Title": title, "Sets": sets, "GeneratedAt": time.Now()}
+		if err := tmpl.ExecuteTemplate(&buf, "report_document.html", data); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), ".html", "text/html; charset=utf-8", nil
+	case "json":
+		if err := writeJSON(&buf, map[string]interface{}{"title": title, "resultSets": toJSONResultSets(sets)}); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), ".json", "application/json; charset=utf-8", nil
+	case "pdf":
+		if config.Scheduler.PDFFont == "" {
+			return nil, "", "", errors.New("не задан шрифт для PDF (scheduler.pdfFont в config.json)")
+		}
+		font, err := loadPDFFont(config.Scheduler.PDFFont)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("шрифт для PDF: %w", err)
+		}
+		if err := writePDF(&buf, font, sets); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), ".pdf", "application/pdf", nil
+	}
+	return nil, "", "", fmt.Errorf("неизвестный формат %q", format)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}_-]+`)
+
+// documentFileName - имя файла из названия и времени, без символов, недопустимых в именах файлов
+func documentFileName(name string, at time.Time, ext string) string {
+	base := strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), "_")
+	if base == "" {
+		base = "report"
+	}
+	return base + "_" + at.Format("20060102_1504") + ext
+}
+
+// deliverToOutbox сохраняет файл в каталог отправки и возвращает путь к нему
+func deliverToOutbox(filename string, data []byte) (string, error) {
+	if err := os.MkdirAll(config.Scheduler.Outbox, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(config.Scheduler.Outbox, filename)
+	return path, os.WriteFile(path, data, 0o644)
+}
+
+// deliverBySMTP отправляет файл письмом через ретранслятор из config.json
+func deliverBySMTP(recipients []string, subject, filename, contentType string, data []byte) error {
+	cfg := config.Scheduler.SMTP
+	if cfg.Host == "" {
+		return errors.New("не задан почтовый сервер (scheduler.smtp.host в config.json)")
+	}
+	if len(recipients) == 0 {
+		return errors.New("не указаны получатели")
+	}
+	boundary := fmt.Sprintf("bookstore-%d", time.Now().UnixNano())
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		cfg.From, strings.Join(recipients, ", "), mime.BEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&msg, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n%s\r\n",
+		boundary, wrapBase64([]byte(subject+"\r\n\r\nОтчет во вложении.")))
+	fmt.Fprintf(&msg, "--%s\r\nContent-Type: %s\r\nContent-Transfer-Encoding: base64\r\nContent-Disposition: attachment; filename=%q\r\n\r\n%s\r\n--%s--\r\n",
+		boundary, contentType, mime.BEncoding.Encode("utf-8", filename), wrapBase64(data), boundary)
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return smtp.SendMail(cfg.Host+":"+strconv.Itoa(cfg.Port), auth, cfg.From, recipients, msg.Bytes())
+}
+
+// wrapBase64 кодирует данные в base64 строками по 76 символов, как требует MIME
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	return b.String()
+}
+
+// truncateText обрезает строку до n символов, чтобы она поместилась в столбец
+func truncateText(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// splitRecipients разбирает список адресов через запятую или точку с запятой
+func splitRecipients(s string) []string {
+	var recipients []string
+	for _, r := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients
+}
+
+// Расписания, которые выполняются сейчас: следующий запуск не начинается, пока не закончился предыдущий
+var (
+	runningSchedules   = make(map[uint]bool)
+	runningSchedulesMu sync.Mutex
+)
+
+// startSchedule запускает расписание в фоне; false - предыдущий запуск еще выполняется
+func startSchedule(s reportSchedule) bool {
+	runningSchedulesMu.Lock()
+	defer runningSchedulesMu.Unlock()
+	if runningSchedules[s.ID] {
+		return false
+	}
+	runningSchedules[s.ID] = true
+	go func() {
+		defer func() {
+			runningSchedulesMu.Lock()
+			delete(runningSchedules, s.ID)
+			runningSchedulesMu.Unlock()
+		}()
+		runSchedule(s)
+	}()
+	return true
+}
+
+// runSchedule выполняет расписание, доставляет результат и записывает запуск в историю.
+// Если запуск не удалось записать, расписание не выполняется: без записи его не будет видно в истории.
+// Расписания создает только администратор, поэтому под подключением пользователя запуск отклоняется.
+func runSchedule(s reportSchedule) scheduleRun {
+	run := scheduleRun{ScheduleID: s.ID, StartedAt: time.Now(), Status: "running"}
+	if err := db().Create(&run).Error; err != nil {
+		fmt.Println("Отчет по расписанию", s.Name, "не запущен: ошибка записи запуска:", err)
+		return run
+	}
+	db().Model(&reportSchedule{}).Where("id = ?", s.ID).Update("last_run_at", run.StartedAt)
+
+	err := func() error {
+		if !roleCovers(dbRole(), "admin") {
+			return errors.New("к базе подключен не администратор, расписание не выполнено")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), statementTimeout("/scheduler"))
+		defer cancel()
+		params, err := url.ParseQuery(s.Params)
+		if err != nil {
+			return err
+		}
+		title, sets, err := executeTarget(ctx, s.Kind, s.Target, params)
+		if err != nil {
+			return errors.New(describeQueryError(ctx, err))
+		}
+		for _, rs := range sets {
+			run.Rows += len(rs.Rows)
+		}
+		data, ext, contentType, err := renderDocument(s.Format, title, sets)
+		if err != nil {
+			return err
+		}
+		filename := documentFileName(s.Name, run.StartedAt, ext)
+		if s.Delivery == "smtp" {
+			recipients := splitRecipients(s.Recipients)
+			run.Output = strings.Join(recipients, ", ")
+			return deliverBySMTP(recipients, s.Name+" — "+run.StartedAt.Format("02.01.2006"), filename, contentType, data)
+		}
+		run.Output, err = deliverToOutbox(filename, data)
+		return err
+	}()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = "ok"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = truncateText(err.Error(), 2000)
+		fmt.Println("Ошибка отчета по расписанию", s.Name+":", err)
+	}
+	if err := db().Save(&run).Error; err != nil {
+		fmt.Println("Ошибка записи результата отчета по расписанию", s.Name+":", err)
+	}
+	return run
+}
+
+// runReportScheduler раз в минуту запускает расписания, срок которых наступил.
+// До первого подключения к базе запуски пропускаются.
+func runReportScheduler() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		conn := db()
+		if conn == nil {
+			continue
+		}
+		minute := time.Now().Truncate(time.Minute)
+		var schedules []reportSchedule
+		if err := conn.Where("enabled = ?", true).Find(&schedules).Error; err != nil {
+			continue // таблицы еще не созданы или база недоступна
+		}
+		for _, s := range schedules {
+			c, err := parseCron(s.Cron)
+			if err != nil || !c.Matches(minute) {
+				continue
+			}
+			if !startSchedule(s) {
+				fmt.Println("Отчет по расписанию", s.Name, "пропущен: предыдущий запуск еще выполняется")
+			}
+		}
+	}
+}
+
+// scheduleTarget - отчет, запрос или процедура для выбора в форме
+type scheduleTarget struct {
+	Value string // вид:id
+	Label string
+}
+
+// scheduleTargets перечисляет все, что можно поставить в расписание
+func scheduleTargets(ctx context.Context) []scheduleTarget {
+	var targets []scheduleTarget
+	for _, rd := range reportRegistry {
+		targets = append(targets, scheduleTarget{Value: "report:" + rd.ID, Label: "Отчет: " + rd.Title})
+	}
+	for _, qd := range queryCatalog {
+		targets = append(targets, scheduleTarget{Value: "query:" + qd.ID, Label: "Запрос: " + qd.Title})
+	}
+	if procs, err := discoverProcedures(ctx); err == nil {
+		for _, pd := range procs {
+			label := pd.FullName()
+			if pd.Title != "" {
+				label += " — " + pd.Title
+			}
+			targets = append(targets, scheduleTarget{Value: "procedure:" + pd.FullName(), Label: "Процедура: " + label})
+		}
+	}
+	return targets
+}
+
+// scheduleSummary - расписание с последним запуском для списка
+type scheduleSummary struct {
+	reportSchedule
+	LastStatus string
+	LastError  string
+}
+
+// renderSchedules выводит список расписаний и форму нового расписания
+func renderSchedules(ctx context.Context, w http.ResponseWriter, form url.Values, message string) {
+	data := map[string]interface{}{
+		"Message": message,
+		"Form":    form,
+		"Formats": documentFormats,
+		"Config":  config.Scheduler,
+	}
+	if currentRole != "admin" {
+		data["Message"] = "Расписания отчетов доступны только администратору."
+	} else {
+		var schedules []scheduleSummary
+		err := db().WithContext(ctx).Raw(`
+            SELECT s.*, COALESCE(r.status, '') AS last_status, COALESCE(r.error, '') AS last_error
+            FROM app_report_schedules s
+            OUTER APPLY (SELECT TOP 1 status, error FROM app_report_schedule_runs WHERE schedule_id = s.id ORDER BY id DESC) r
+            ORDER BY s.name`).Scan(&schedules).Error
+		if err != nil {
+			data["Message"] = strings.TrimSpace(message + " Ошибка получения расписаний: " + describeQueryError(ctx, err))
+		}
+		data["Schedules"] = schedules
+		data["Targets"] = scheduleTargets(ctx)
+	}
+	if err := tmpl.ExecuteTemplate(w, "schedules.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderSchedule выводит расписание с историей запусков
+func renderSchedule(ctx context.Context, w http.ResponseWriter, id int, message string) {
+	var s reportSchedule
+	if currentRole != "admin" || db().WithContext(ctx).First(&s, id).Error != nil {
+		renderSchedules(ctx, w, url.Values{}, "Расписание не найдено.")
+		return
+	}
+	data := map[string]interface{}{
+		"Message":  message,
+		"Schedule": s,
+		"Kind":     targetKinds[s.Kind],
+		"Format":   documentFormats[s.Format],
+	}
+	var runs []scheduleRun
+	if err := db().WithContext(ctx).Where("schedule_id = ?", id).Order("id DESC").Limit(100).Find(&runs).Error; err != nil {
+		data["Message"] = strings.TrimSpace(message + " Ошибка получения истории: " + describeQueryError(ctx, err))
+	}
+	data["Runs"] = runs
+	if err := tmpl.ExecuteTemplate(w, "schedule_view.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// scheduleFromForm проверяет форму нового расписания
+func scheduleFromForm(ctx context.Context, form url.Values) (reportSchedule, error) {
+	s := reportSchedule{
+		Name:       strings.TrimSpace(form.Get("name")),
+		Cron:       strings.Join(strings.Fields(form.Get("cron")), " "),
+		Format:     form.Get("format"),
+		Delivery:   form.Get("delivery"),
+		Recipients: strings.Join(splitRecipients(form.Get("recipients")), ", "),
+		Enabled:    true,
+		CreatedBy:  currentUser,
+	}
+	s.Kind, s.Target, _ = strings.Cut(form.Get("target"), ":")
+	if s.Name == "" {
+		return s, errors.New("укажите название")
+	}
+	if _, err := parseCron(s.Cron); err != nil {
+		return s, fmt.Errorf("расписание: %w", err)
+	}
+	if _, ok := documentFormats[s.Format]; !ok {
+		return s, errors.New("выберите формат")
+	}
+	switch s.Delivery {
+	case "outbox":
+	case "smtp":
+		if s.Recipients == "" {
+			return s, errors.New("укажите получателей письма")
+		}
+	default:
+		return s, errors.New("выберите способ доставки")
+	}
+	params, err := parseParamsText(form.Get("params"))
+	if err != nil {
+		return s, err
+	}
+	defs, _, err := targetParams(ctx, s.Kind, s.Target)
+	if err != nil {
+		return s, err
+	}
+	known := make(map[string]bool, len(defs))
+	for _, p := range defs {
+		known[p.Name] = true
+	}
+	for name := range params {
+		if !known[name] {
+			return s, fmt.Errorf("неизвестный параметр %q", name)
+		}
+	}
+	if _, fieldErrors := parseParams(defs, params); len(fieldErrors) > 0 {
+		return s, errors.New("ошибка в параметрах: " + paramErrorsText(defs, fieldErrors))
+	}
+	s.Params = params.Encode()
+	return s, nil
+}
+
+func registerSchedulerHandlers() {
+	http.HandleFunc("/schedules", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderSchedules(ctx, w, url.Values{"format": {"csv"}, "delivery": {"outbox"}, "cron": {"0 8 * * 1"}}, "")
+	})
+
+	http.HandleFunc("/schedule", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderSchedules(ctx, w, url.Values{}, "Некорректный номер расписания.")
+			return
+		}
+		renderSchedule(ctx, w, id, "")
+	})
+
+	// создание, включение и выключение, удаление и запуск вне расписания
+	http.HandleFunc("/schedule_update", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderSchedules(ctx, w, url.Values{}, "Ошибка при обработке формы.")
+			return
+		}
+		if r.FormValue("action") == "create" {
+			s, err := scheduleFromForm(ctx, r.Form)
+			if err != nil {
+				renderSchedules(ctx, w, r.Form, "Ошибка в расписании: "+describeQueryError(ctx, err))
+				return
+			}
+			err = db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&s).Error; err != nil {
+					return err
+				}
+				return writeAudit(tx, "create", "schedule", strconv.Itoa(int(s.ID)), s.Name+": "+s.Cron)
+			})
+			if err != nil {
+				renderSchedules(ctx, w, r.Form, "Ошибка сохранения расписания: "+describeQueryError(ctx, err))
+				return
+			}
+			renderSchedule(ctx, w, int(s.ID), "✅ Расписание создано.")
+			return
+		}
+
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		var s reportSchedule
+		if err := db().WithContext(ctx).First(&s, id).Error; err != nil {
+			renderSchedules(ctx, w, url.Values{}, "Расписание не найдено.")
+			return
+		}
+		switch r.FormValue("action") {
+		case "toggle":
+			err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&s).Update("enabled", !s.Enabled).Error; err != nil {
+					return err
+				}
+				return writeAudit(tx, "toggle", "schedule", strconv.Itoa(id), fmt.Sprintf("включено: %t", s.Enabled))
+			})
+			if err != nil {
+				renderSchedule(ctx, w, id, "Ошибка изменения расписания: "+describeQueryError(ctx, err))
+				return
+			}
+			renderSchedule(ctx, w, id, "✅ Расписание изменено.")
+		case "delete":
+			err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("schedule_id = ?", id).Delete(&scheduleRun{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&s).Error; err != nil {
+					return err
+				}
+				return writeAudit(tx, "delete", "schedule", strconv.Itoa(id), s.Name)
+			})
+			if err != nil {
+				renderSchedule(ctx, w, id, "Ошибка удаления расписания: "+describeQueryError(ctx, err))
+				return
+			}
+			renderSchedules(ctx, w, url.Values{}, "✅ Расписание удалено.")
+		case "run":
+			if !startSchedule(s) {
+				renderSchedule(ctx, w, id, "Предыдущий запуск еще выполняется.")
+				return
+			}
+			renderSchedule(ctx, w, id, "✅ Запуск начат, результат появится в истории запусков.")
+		default:
+			renderSchedule(ctx, w, id, "Неизвестное действие.")
+		}
+	})
+}
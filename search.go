@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// searchField - поле книги, в котором найдено слово
+type searchField int
+
+const (
+	fieldBookName searchField = iota
+	fieldAuthor
+	fieldPublisher
+	fieldSection
+)
+
+// searchWeights - вес совпадения по полю: название важнее автора, автор важнее раздела и издательства
+var searchWeights = map[searchField]int{
+	fieldBookName:  4,
+	fieldAuthor:    3,
+	fieldSection:   2,
+	fieldPublisher: 1,
+}
+
+// normalizeSearchText приводит текст к нижнему регистру и убирает диакритику.
+// Ё приравнивается к Е, а Й сохраняется, так как в русском это отдельная буква.
+func normalizeSearchText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch r {
+		case 'ё':
+			b.WriteRune('е')
+			continue
+		case 'й':
+			b.WriteRune(r)
+			continue
+		}
+		for _, d := range norm.NFD.String(string(r)) {
+			if !unicode.Is(unicode.Mn, d) {
+				b.WriteRune(d)
+			}
+		}
+	}
+	return b.String()
+}
+
+// searchTokens разбивает текст на нормализованные слова
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(normalizeSearchText(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchPosting - вхождение слова в поле книги
+type searchPosting struct {
+	BookCode int
+	Field    searchField
+}
+
+// searchIndex - обратный индекс слов из названий книг, имен авторов, издательств и разделов
+type searchIndex struct {
+	terms    []string // отсортированные слова для поиска по префиксу
+	postings map[string][]searchPosting
+	names    map[int]string
+	builtAt  time.Time
+}
+
+func (idx *searchIndex) add(bookCode int, field searchField, text string) {
+	for _, t := range searchTokens(text) {
+		if _, ok := idx.postings[t]; !ok {
+			idx.terms = append(idx.terms, t)
+		}
+		idx.postings[t] = append(idx.postings[t], searchPosting{BookCode: bookCode, Field: field})
+	}
+}
+
+// searchHit - найденная книга и ее релевантность
+type searchHit struct {
+	BookCode int
+	Score    int
+}
+
+// search возвращает книги, в которых встречаются все слова запроса. Слово запроса может быть
+// началом слова в индексе, полное совпадение ценится вдвое выше.
+func (idx *searchIndex) search(query string, limit int) []searchHit {
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+	total := map[int]int{}
+	for i, token := range tokens {
+		best := map[int]int{}
+		for j := sort.SearchStrings(idx.terms, token); j < len(idx.terms) && strings.HasPrefix(idx.terms[j], token); j++ {
+			term := idx.terms[j]
+			factor := 1
+			if term == token {
+				factor = 2
+			}
+			for _, p := range idx.postings[term] {
+				if score := searchWeights[p.Field] * factor; score > best[p.BookCode] {
+					best[p.BookCode] = score
+				}
+			}
+		}
+		// Книга остается в результатах, только если совпали все слова запроса
+		next := map[int]int{}
+		for code, score := range best {
+			if prev, ok := total[code]; ok || i == 0 {
+				next[code] = prev + score
+			}
+		}
+		total = next
+	}
+
+	hits := make([]searchHit, 0, len(total))
+	for code, score := range total {
+		hits = append(hits, searchHit{BookCode: code, Score: score})
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		return idx.names[hits[a].BookCode] < idx.names[hits[b].BookCode]
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// buildSearchIndex читает книги, авторов с вариантами имени, издательства и разделы одним проходом
+func buildSearchIndex(ctx context.Context) (*searchIndex, error) {
+	var books []struct {
+		BookCode      int
+		Name          string
+		AuthorName    string
+		PublisherName string
+		SectionName   string
+	}
+	err := db().WithContext(ctx).Raw(`
+        SELECT b.BookCode, b.Name, COALESCE(a.FullName, '') AS AuthorName,
+               COALESCE(p.Name, '') AS PublisherName, COALESCE(c.Name, '') AS SectionName
+        FROM Books b
+        LEFT JOIN Authors a ON a.AuthorID = b.AuthorID
+        LEFT JOIN Publishers p ON p.PublisherCode = b.PublisherCode
+        LEFT JOIN Classifier c ON c.ClassifierCode = b.ClassifierCode`).Scan(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	var variants []struct {
+		BookCode int
+		FullName string
+	}
+	err = db().WithContext(ctx).Raw(`
+        SELECT b.BookCode, n.FullName
+        FROM Books b
+        JOIN AuthorNames n ON n.AuthorID = b.AuthorID`).Scan(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &searchIndex{postings: map[string][]searchPosting{}, names: map[int]string{}, builtAt: time.Now()}
+	for _, b := range books {
+		idx.names[b.BookCode] = b.Name
+		idx.add(b.BookCode, fieldBookName, b.Name)
+		idx.add(b.BookCode, fieldAuthor, b.AuthorName)
+		idx.add(b.BookCode, fieldPublisher, b.PublisherName)
+		idx.add(b.BookCode, fieldSection, b.SectionName)
+	}
+	for _, v := range variants {
+		idx.add(v.BookCode, fieldAuthor, v.FullName)
+	}
+	sort.Strings(idx.terms)
+	return idx, nil
+}
+
+var searchState struct {
+	sync.Mutex
+	index *searchIndex
+}
+
+// currentSearchIndex возвращает индекс, перестраивая его, если он устарел или сброшен
+func currentSearchIndex(ctx context.Context) (*searchIndex, error) {
+	searchState.Lock()
+	defer searchState.Unlock()
+	if searchState.index != nil && time.Since(searchState.index.builtAt) < config.Search.indexRefresh {
+		return searchState.index, nil
+	}
+	idx, err := buildSearchIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	searchState.index = idx
+	return idx, nil
+}
+
+// invalidateSearchIndex сбрасывает индекс после изменения данных, он будет перестроен при следующем поиске
+func invalidateSearchIndex() {
+	searchState.Lock()
+	searchState.index = nil
+	searchState.Unlock()
+}
+
+// searchInDatabase ищет без индекса: каждое слово должно встретиться хотя бы в одном поле.
+// Сопоставление Cyrillic_General_CI_AI не учитывает регистр и диакритику, но приравнивает Й к И,
+// а индекс их различает. Поэтому для слов с И или Й добавляется проверка с учетом диакритики
+// (Cyrillic_General_CI_AS), где Ё заменяется на Е, как в normalizeSearchText.
+func searchInDatabase(ctx context.Context, query string, limit int) ([]searchHit, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	var scores, conditions []string
+	var scoreArgs, condArgs []interface{}
+	for _, word := range words {
+		like, args := searchLike(word)
+		name := like("b.Name")
+		author := "(" + like("a.FullName") + " OR EXISTS (SELECT 1 FROM AuthorNames n WHERE n.AuthorID = b.AuthorID AND " + like("n.FullName") + "))"
+		section := like("c.Name")
+		publisher := like("p.Name")
+		// пять условий: название, автор, вариант имени автора, раздел и издательство
+		var fieldArgs []interface{}
+		for i := 0; i < 5; i++ {
+			fieldArgs = append(fieldArgs, args...)
+		}
+		scores = append(scores,
+			"CASE WHEN "+name+" THEN 4 WHEN "+author+" THEN 3 WHEN "+section+" THEN 2 WHEN "+publisher+" THEN 1 ELSE 0 END")
+		scoreArgs = append(scoreArgs, fieldArgs...)
+		conditions = append(conditions, "("+name+" OR "+author+" OR "+section+" OR "+publisher+")")
+		condArgs = append(condArgs, fieldArgs...)
+	}
+	var hits []searchHit
+	err := db().WithContext(ctx).Raw(`
+        SELECT TOP (?) b.BookCode, `+strings.Join(scores, " + ")+` AS Score
+        FROM Books b
+        LEFT JOIN Authors a ON a.AuthorID = b.AuthorID
+        LEFT JOIN Publishers p ON p.PublisherCode = b.PublisherCode
+        LEFT JOIN Classifier c ON c.ClassifierCode = b.ClassifierCode
+        WHERE `+strings.Join(conditions, " AND ")+`
+        ORDER BY Score DESC, b.Name`,
+		append(append([]interface{}{limit}, scoreArgs...), condArgs...)...).Scan(&hits).Error
+	return hits, err
+}
+
+// searchLike возвращает условие совпадения слова со столбцом и параметры для одного такого условия
+func searchLike(word string) (func(column string) string, []interface{}) {
+	pattern := "%" + escapeLike(word) + "%"
+	folded := normalizeSearchText(word)
+	if !strings.ContainsAny(folded, "ий") {
+		return func(column string) string {
+			return column + " COLLATE Cyrillic_General_CI_AI LIKE ?"
+		}, []interface{}{pattern}
+	}
+	return func(column string) string {
+		return "(" + column + " COLLATE Cyrillic_General_CI_AI LIKE ? AND REPLACE(" + column +
+			" COLLATE Cyrillic_General_CI_AS, N'ё', N'е') LIKE ?)"
+	}, []interface{}{pattern, "%" + escapeLike(folded) + "%"}
+}
+
+// escapeLike экранирует символы шаблона LIKE, чтобы искать их буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer("[", "[[]", "%", "[%]", "_", "[_]").Replace(s)
+}
+
+// searchResult - найденная книга для вывода
+type searchResult struct {
+	bookCard
+	Score int
+}
+
+// searchBooks ищет книги по индексу или, если он отключен в config.json, запросом к базе,
+// и дополняет найденное актуальными ценами и остатками
+func searchBooks(ctx context.Context, query string) ([]searchResult, error) {
+	var hits []searchHit
+	var err error
+	if config.Search.UseIndex {
+		var idx *searchIndex
+		if idx, err = currentSearchIndex(ctx); err == nil {
+			hits = idx.search(query, config.Search.Limit)
+		}
+	} else {
+		hits, err = searchInDatabase(ctx, query, config.Search.Limit)
+	}
+	if err != nil || len(hits) == 0 {
+		return nil, err
+	}
+
+	codes := make([]int, len(hits))
+	for i, h := range hits {
+		codes[i] = h.BookCode
+	}
+	var cards []bookCard
+	if err := db().WithContext(ctx).Raw(bookCardSelect+" WHERE b.BookCode IN ?", codes).Scan(&cards).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[int]bookCard, len(cards))
+	for _, c := range cards {
+		byCode[c.BookCode] = c
+	}
+	results := make([]searchResult, 0, len(hits))
+	for _, h := range hits {
+		// Книга могла быть удалена после построения индекса
+		if card, ok := byCode[h.BookCode]; ok {
+			results = append(results, searchResult{bookCard: card, Score: h.Score})
+		}
+	}
+	return results, nil
+}
+
+func registerSearchHandlers() {
+	http.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		data := map[string]interface{}{"Query": query}
+		if query != "" {
+			results, err := searchBooks(ctx, query)
+			if err != nil {
+				data["Message"] = "Ошибка поиска: " + describeQueryError(ctx, err)
+			} else if len(results) == 0 {
+				data["Message"] = "Ничего не найдено."
+			}
+			data["Results"] = results
+		}
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writeJSON(w, data)
+			return
+		}
+		if err := tmpl.ExecuteTemplate(w, "search.html", data); err != nil {
+			http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeSearchText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"ЁЖИК", "ежик"},
+		{"Йогурт", "йогурт"},
+		{"Café Crème", "cafe creme"},
+		{"Чайковский", "чайковский"},
+	}
+	for _, tt := range tests {
+		if got := normalizeSearchText(tt.in); got != tt.want {
+			t.Errorf("normalizeSearchText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearchLike(t *testing.T) {
+	tests := []struct {
+		word      string
+		args      []interface{}
+		sensitive bool // добавлена проверка с учетом диакритики
+	}{
+		{"Толстой", []interface{}{"%Толстой%", "%толстой%"}, true},
+		{"Ёлка", []interface{}{"%Ёлка%"}, false},
+		{"ёжик", []interface{}{"%ёжик%", "%ежик%"}, true},
+		{"café", []interface{}{"%café%"}, false},
+		{"50%_[", []interface{}{"%50[%][_][[]%"}, false},
+	}
+	for _, tt := range tests {
+		like, args := searchLike(tt.word)
+		cond := like("b.Name")
+		if got := strings.Count(cond, "?"); got != len(args) {
+			t.Errorf("searchLike(%q): %d параметров в условии и %d значений", tt.word, got, len(args))
+		}
+		if strings.Contains(cond, "CI_AS") != tt.sensitive {
+			t.Errorf("searchLike(%q): условие %q", tt.word, cond)
+		}
+		if len(args) != len(tt.args) {
+			t.Errorf("searchLike(%q) = %q, want %q", tt.word, args, tt.args)
+			continue
+		}
+		for i := range args {
+			if args[i] != tt.args[i] {
+				t.Errorf("searchLike(%q) = %q, want %q", tt.word, args, tt.args)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// consoleQuery - запрос из SQL-консоли в истории пользователя
+type consoleQuery struct {
+	ID         uint   `gorm:"primaryKey"`
+	Login      string `gorm:"size:100;index"`
+	SQL        string `gorm:"type:nvarchar(max)"`
+	RanAt      time.Time
+	DurationMs int64
+	Rows       int
+	Truncated  bool
+	Status     string `gorm:"size:20"` // ok, rejected или failed
+	Error      string `gorm:"size:2000"`
+}
+
+func (consoleQuery) TableName() string { return "app_console_history" }
+
+func init() {
+	registerModels(&consoleQuery{})
+}
+
+// Preview - начало запроса для списка истории
+func (q consoleQuery) Preview() string {
+	text := strings.Join(strings.Fields(q.SQL), " ")
+	if short := truncateText(text, 120); short != text {
+		return short + "…"
+	}
+	return text
+}
+
+// errSnapshotDisabled - в базе не разрешена изоляция SNAPSHOT (ошибка SQL Server 3952)
+var errSnapshotDisabled = errors.New("консоль выполняет запросы в транзакции SNAPSHOT, а в базе она не разрешена: " +
+	"администратор базы должен выполнить ALTER DATABASE <база> SET ALLOW_SNAPSHOT_ISOLATION ON")
+
+// runConsoleQuery выполняет пакет в транзакции с уровнем изоляции SNAPSHOT и всегда откатывает ее
+func runConsoleQuery(ctx context.Context, text string) ([]*resultSet, bool, error) {
+	sets, truncated, err := runSnapshotBatch(ctx, text)
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) {
+		for _, e := range append([]mssql.Error{sqlErr}, sqlErr.All...) {
+			if e.Number == 3952 {
+				return nil, false, errSnapshotDisabled
+			}
+		}
+	}
+	return sets, truncated, err
+}
+
+// runSnapshotBatch выполняет пакет в транзакции SNAPSHOT. SET ROWCOUNT ограничивает строки на сервере;
+// настройка сбрасывается вместе с сеансом, когда соединение возвращается в пул.
+func runSnapshotBatch(ctx context.Context, text string) ([]*resultSet, bool, error) {
+	sqlDB, err := db().DB()
+	if err != nil {
+		return nil, false, err
+	}
+	tx, err := sqlDB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSnapshot})
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	maxRows := config.Console.MaxRows
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET ROWCOUNT %d", maxRows+1)); err != nil {
+		return nil, false, err
+	}
+	rows, err := tx.QueryContext(ctx, text)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var sets []*resultSet
+	truncated := false
+	for {
+		rs, more, err := scanResultSetLimit(rows, maxRows)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(rs.Columns) > 0 {
+			rs.Title = fmt.Sprintf("Набор результатов %d", len(sets)+1)
+			sets = append(sets, rs)
+		}
+		truncated = truncated || more
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return sets, truncated, nil
+}
+
+// renderConsole выводит консоль с историей запросов текущего пользователя
+func renderConsole(ctx context.Context, w http.ResponseWriter, text string, sets []*resultSet, truncated bool, message string) {
+	data := map[string]interface{}{
+		"Message":   message,
+		"SQL":       text,
+		"Sets":      sets,
+		"Truncated": truncated,
+		"MaxRows":   config.Console.MaxRows,
+		"Timeout":   statementTimeout("/sql_console_run").String(),
+	}
+	if currentRole != "admin" {
+		data["Message"] = "SQL-консоль доступна только администратору."
+	} else {
+		var history []consoleQuery
+		if err := db().WithContext(ctx).Where("login = ?", currentUser).Order("id DESC").Limit(50).Find(&history).Error; err != nil {
+			data["Message"] = strings.TrimSpace(message + " Ошибка получения истории: " + describeQueryError(ctx, err))
+		}
+		data["History"] = history
+	}
+	if err := tmpl.ExecuteTemplate(w, "sql_console.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerConsoleHandlers() {
+	// ?history=id подставляет запрос из истории в поле ввода
+	http.HandleFunc("/sql_console", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		text := ""
+		if id, err := strconv.Atoi(r.URL.Query().Get("history")); err == nil && currentRole == "admin" {
+			var q consoleQuery
+			if db().WithContext(ctx).Where("login = ?", currentUser).First(&q, id).Error == nil {
+				text = q.SQL
+			}
+		}
+		renderConsole(ctx, w, text, nil, false, "")
+	})
+
+	http.HandleFunc("/sql_console_run", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderConsole(ctx, w, "", nil, false, "Ошибка при обработке формы.")
+			return
+		}
+		text := strings.TrimSpace(r.FormValue("sql"))
+		entry := consoleQuery{Login: currentUser, SQL: text, RanAt: time.Now(), Status: "ok"}
+
+		var sets []*resultSet
+		var truncated bool
+		err := checkReadOnlySQL(text)
+		if err != nil {
+			entry.Status = "rejected"
+		} else {
+			sets, truncated, err = runConsoleQuery(ctx, text)
+			if err != nil {
+				entry.Status = "failed"
+			}
+		}
+		entry.DurationMs = time.Since(entry.RanAt).Milliseconds()
+		entry.Truncated = truncated
+		for _, rs := range sets {
+			entry.Rows += len(rs.Rows)
+		}
+		message := fmt.Sprintf("✅ Выполнено за %d мс, строк: %d.", entry.DurationMs, entry.Rows)
+		if err != nil {
+			entry.Error = truncateText(describeQueryError(ctx, err), 2000)
+			if entry.Status == "rejected" {
+				message = "Запрос отклонен: " + entry.Error
+			} else {
+				message = "Ошибка выполнения запроса: " + entry.Error
+			}
+		}
+
+		// Историю и страницу пишем с новым контекстом: контекст запроса мог истечь
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), statementTimeout("default"))
+		defer saveCancel()
+		if err := db().WithContext(saveCtx).Create(&entry).Error; err != nil {
+			message += " Запрос не сохранен в историю: " + err.Error()
+		}
+		renderConsole(saveCtx, w, text, sets, truncated, message)
+	})
+}
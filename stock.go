@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// stockThreshold - минимальный остаток для книги или для раздела классификатора
+type stockThreshold struct {
+	ID             uint    `gorm:"primaryKey"`
+	BookCode       *int    `gorm:"index"`
+	ClassifierCode *string `gorm:"size:50;index"`
+	MinCopies      int
+}
+
+func (stockThreshold) TableName() string { return "app_stock_thresholds" }
+
+func init() {
+	registerModels(&stockThreshold{})
+}
+
+// thresholdView - порог с названием книги или раздела для отображения
+type thresholdView struct {
+	ID        uint
+	Kind      string
+	Code      string
+	Name      string
+	MinCopies int
+}
+
+// lowStockBook - книга с остатком ниже порога и данными для дозаказа
+type lowStockBook struct {
+	BookCode       int
+	Name           string
+	PublisherCode  int
+	PublisherName  string
+	NumberOfCopies int
+	MinCopies      int
+	SoldRecently   int
+	Suggested      int
+}
+
+// DailyVelocity - средние продажи в день за период расчета
+func (b lowStockBook) DailyVelocity() float64 {
+	if config.Stock.VelocityDays <= 0 {
+		return 0
+	}
+	return float64(b.SoldRecently) / float64(config.Stock.VelocityDays)
+}
+
+// publisherReorder - предложение дозаказа по одному издательству
+type publisherReorder struct {
+	PublisherCode int
+	PublisherName string
+	Books         []lowStockBook
+	TotalCopies   int
+}
+
+// lowStockBooks возвращает книги, остаток которых ниже порога. Порог книги важнее порога раздела,
+// порог раздела важнее значения по умолчанию из config.json.
+func lowStockBooks(ctx context.Context) ([]lowStockBook, error) {
+	var books []lowStockBook
+	since := time.Now().AddDate(0, 0, -config.Stock.VelocityDays)
+	err := db().WithContext(ctx).Raw(`
+        SELECT b.BookCode, b.Name, b.PublisherCode, COALESCE(p.Name, '') AS PublisherName, w.NumberOfCopies,
+               COALESCE(tb.min_copies, tc.min_copies, @def) AS MinCopies,
+               COALESCE(sv.Sold, 0) AS SoldRecently
+        FROM Warehouse w
+        JOIN Books b ON b.BookCode = w.BookCode
+        LEFT JOIN Publishers p ON p.PublisherCode = b.PublisherCode
+        LEFT JOIN app_stock_thresholds tb ON tb.book_code = b.BookCode
+        LEFT JOIN app_stock_thresholds tc ON tc.book_code IS NULL AND tc.classifier_code = CAST(b.ClassifierCode AS nvarchar(50))
+        LEFT JOIN (
+            SELECT BookID, SUM(Quantity) AS Sold FROM Sales WHERE SaleDate >= @since GROUP BY BookID
+        ) sv ON sv.BookID = b.BookCode
+        WHERE w.NumberOfCopies < COALESCE(tb.min_copies, tc.min_copies, @def)
+        ORDER BY PublisherName, b.Name`,
+		map[string]interface{}{"def": config.Stock.DefaultMinCopies, "since": since}).Scan(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range books {
+		books[i].Suggested = reorderQuantity(books[i])
+	}
+	return books, nil
+}
+
+// reorderQuantity - сколько заказать, чтобы остаток покрыл продажи на coverDays и был не ниже порога.
+// Вызывается только для книг с остатком ниже порога, поэтому результат всегда положителен.
+func reorderQuantity(b lowStockBook) int {
+	target := int(math.Ceil(b.DailyVelocity() * float64(config.Stock.CoverDays)))
+	if target < b.MinCopies {
+		target = b.MinCopies
+	}
+	return target - b.NumberOfCopies
+}
+
+// groupReorders группирует предложения дозаказа по издательствам
+func groupReorders(books []lowStockBook) []publisherReorder {
+	var groups []publisherReorder
+	index := make(map[int]int)
+	for _, b := range books {
+		i, ok := index[b.PublisherCode]
+		if !ok {
+			i = len(groups)
+			index[b.PublisherCode] = i
+			groups = append(groups, publisherReorder{PublisherCode: b.PublisherCode, PublisherName: b.PublisherName})
+		}
+		groups[i].Books = append(groups[i].Books, b)
+		groups[i].TotalCopies += b.Suggested
+	}
+	return groups
+}
+
+// listThresholds возвращает заданные пороги с названиями книг и разделов
+func listThresholds(ctx context.Context) ([]thresholdView, error) {
+	var thresholds []thresholdView
+	err := db().WithContext(ctx).Raw(`
+        SELECT t.id AS ID,
+               CASE WHEN t.book_code IS NOT NULL THEN N'Книга' ELSE N'Раздел' END AS Kind,
+               COALESCE(CAST(t.book_code AS nvarchar(50)), t.classifier_code) AS Code,
+               COALESCE(b.Name, c.Name, '') AS Name,
+               t.min_copies AS MinCopies
+        FROM app_stock_thresholds t
+        LEFT JOIN Books b ON b.BookCode = t.book_code
+        LEFT JOIN Classifier c ON CAST(c.ClassifierCode AS nvarchar(50)) = t.classifier_code
+        ORDER BY Kind, Code`).Scan(&thresholds).Error
+	return thresholds, err
+}
+
+// saveThreshold задает порог для книги или раздела, заменяя прежний
+func saveThreshold(ctx context.Context, t stockThreshold) error {
+	return db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("book_code IS NULL AND classifier_code = ?", t.ClassifierCode)
+		if t.BookCode != nil {
+			q = tx.Where("book_code = ?", *t.BookCode)
+		}
+		if err := q.Delete(&stockThreshold{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&t).Error
+	})
+}
+
+// renderStockAlerts выводит панель остатков: пороги, книги ниже порога и предложения дозаказа
+func renderStockAlerts(ctx context.Context, w http.ResponseWriter, message string) {
+	books, err := lowStockBooks(ctx)
+	if err != nil {
+		message = "Ошибка расчета остатков: " + describeQueryError(ctx, err)
+	}
+	thresholds, err := listThresholds(ctx)
+	if err != nil {
+		message = "Ошибка получения порогов: " + describeQueryError(ctx, err)
+	}
+	data := map[string]interface{}{
+		"Message":    message,
+		"Books":      books,
+		"Reorders":   groupReorders(books),
+		"Thresholds": thresholds,
+		"Stock":      config.Stock,
+	}
+	if err := tmpl.ExecuteTemplate(w, "stock_alerts.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerStockHandlers() {
+	http.HandleFunc("/stock_alerts", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderStockAlerts(ctx, w, "Книги с остатком ниже минимального.")
+	})
+
+	http.HandleFunc("/stock_threshold", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderStockAlerts(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		minCopies, err := strconv.Atoi(r.FormValue("minCopies"))
+		if err != nil || minCopies < 0 {
+			renderStockAlerts(ctx, w, "Минимальный остаток должен быть неотрицательным целым числом.")
+			return
+		}
+		t := stockThreshold{MinCopies: minCopies}
+		code := strings.TrimSpace(r.FormValue("code"))
+		switch r.FormValue("kind") {
+		case "book":
+			bookCode, err := strconv.Atoi(code)
+			if err != nil {
+				renderStockAlerts(ctx, w, "Код книги должен быть числом.")
+				return
+			}
+			t.BookCode = &bookCode
+		case "classifier":
+			if code == "" {
+				renderStockAlerts(ctx, w, "Укажите код раздела классификатора.")
+				return
+			}
+			t.ClassifierCode = &code
+		default:
+			renderStockAlerts(ctx, w, "Выберите, к чему относится порог.")
+			return
+		}
+		if err := saveThreshold(ctx, t); err != nil {
+			renderStockAlerts(ctx, w, "Ошибка сохранения порога: "+describeQueryError(ctx, err))
+			return
+		}
+		renderStockAlerts(ctx, w, "✅ Порог сохранен.")
+	})
+
+	http.HandleFunc("/stock_threshold_delete", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderStockAlerts(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			renderStockAlerts(ctx, w, "Некорректный порог.")
+			return
+		}
+		if err := db().WithContext(ctx).Delete(&stockThreshold{}, id).Error; err != nil {
+			renderStockAlerts(ctx, w, "Ошибка удаления порога: "+describeQueryError(ctx, err))
+			return
+		}
+		renderStockAlerts(ctx, w, "✅ Порог удален.")
+	})
+
+	// выгрузка предложений дозаказа для отправки издательствам
+	http.HandleFunc("/stock_reorder_export", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		books, err := lowStockBooks(ctx)
+		if err != nil {
+			renderStockAlerts(ctx, w, "Ошибка расчета остатков: "+describeQueryError(ctx, err))
+			return
+		}
+		var sets []*resultSet
+		for _, g := range groupReorders(books) {
+			rs := &resultSet{Title: g.PublisherName, Columns: []string{"Код книги", "Название", "Остаток", "Минимум", "Продано за период", "Заказать"}}
+			for _, b := range g.Books {
+				rs.Rows = append(rs.Rows, []interface{}{b.BookCode, b.Name, b.NumberOfCopies, b.MinCopies, b.SoldRecently, b.Suggested})
+			}
+			sets = append(sets, rs)
+		}
+		setDownloadHeaders(w, "reorder_"+time.Now().Format("20060102")+".csv", "text/csv; charset=utf-8")
+		writeCSV(w, sets)
+	})
+}
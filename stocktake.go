@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Состояния инвентаризации
+const (
+	stocktakeOpen      = "open"
+	stocktakeApproved  = "approved"
+	stocktakeCancelled = "cancelled"
+)
+
+var stocktakeStatusLabels = map[string]string{
+	stocktakeOpen:      "Идет подсчет",
+	stocktakeApproved:  "Утверждена",
+	stocktakeCancelled: "Отменена",
+}
+
+// stocktake - сессия инвентаризации склада
+type stocktake struct {
+	ID         uint   `gorm:"primaryKey"`
+	Note       string `gorm:"size:400"`
+	Status     string `gorm:"size:20"`
+	OpenedBy   string `gorm:"size:100"`
+	OpenedAt   time.Time
+	ApprovedBy string `gorm:"size:100"`
+	ApprovedAt *time.Time
+}
+
+func (stocktake) TableName() string { return "app_stocktakes" }
+
+// StatusLabel возвращает название состояния на русском
+func (s stocktake) StatusLabel() string { return stocktakeStatusLabels[s.Status] }
+
+// stocktakeCount - учетный и фактический остаток книги в сессии.
+// При открытии сессии SystemQty - остаток на этот момент; при вводе подсчета он заменяется остатком
+// склада на момент подсчета. Продажи, поступления и резервы до подсчета уже учтены и на полке,
+// и в Warehouse, а после подсчета - только в Warehouse, поэтому расхождение прибавляется
+// к текущему остатку при утверждении и ни одно движение не учитывается дважды.
+type stocktakeCount struct {
+	ID          uint `gorm:"primaryKey"`
+	StocktakeID uint `gorm:"index"`
+	BookCode    int
+	Title       string          `gorm:"size:400"`
+	Price       decimal.Decimal `gorm:"type:decimal(18,2)"`
+	SystemQty   int
+	CountedQty  *int
+}
+
+func (stocktakeCount) TableName() string { return "app_stocktake_counts" }
+
+// recordCount записывает фактический остаток вместе с остатком склада на момент подсчета
+func (c *stocktakeCount) recordCount(counted, warehouseQty int) {
+	c.CountedQty = &counted
+	c.SystemQty = warehouseQty
+}
+
+// Variance - расхождение фактического остатка с учетным
+func (c stocktakeCount) Variance() int {
+	if c.CountedQty == nil {
+		return 0
+	}
+	return *c.CountedQty - c.SystemQty
+}
+
+// VarianceValue - расхождение в деньгах по цене склада
+func (c stocktakeCount) VarianceValue() decimal.Decimal {
+	return c.Price.Mul(decimal.NewFromInt(int64(c.Variance())))
+}
+
+func init() {
+	registerModels(&stocktake{}, &stocktakeCount{})
+}
+
+// openStocktake создает сессию и фиксирует текущие остатки склада
+func openStocktake(ctx context.Context, note string) (*stocktake, error) {
+	st := &stocktake{Note: note, Status: stocktakeOpen, OpenedBy: currentUser, OpenedAt: time.Now()}
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(st).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+            INSERT INTO app_stocktake_counts (stocktake_id, book_code, title, price, system_qty)
+            SELECT ?, w.BookCode, b.Name, w.Price, w.NumberOfCopies
+            FROM Warehouse w JOIN Books b ON b.BookCode = w.BookCode`, st.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// saveCounts записывает фактические остатки и возвращает число сохраненных позиций;
+// книги, которых нет в сессии, возвращаются как ошибки
+func saveCounts(ctx context.Context, id uint, counts map[int]int) (int, []string) {
+	var problems []string
+	saved := 0
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var st stocktake
+		if err := tx.First(&st, id).Error; err != nil {
+			return err
+		}
+		if st.Status != stocktakeOpen {
+			return errors.New("инвентаризация уже закрыта")
+		}
+		codes := make([]int, 0, len(counts))
+		for bookCode := range counts {
+			codes = append(codes, bookCode)
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		// Остатки склада на момент подсчета; блокировка не дает продать книгу, пока подсчет записывается
+		var stock []struct {
+			BookCode       int
+			NumberOfCopies int
+		}
+		if err := tx.Raw("SELECT BookCode, NumberOfCopies FROM Warehouse WITH (UPDLOCK) WHERE BookCode IN ?", codes).Scan(&stock).Error; err != nil {
+			return err
+		}
+		warehouseQty := make(map[int]int, len(stock))
+		for _, w := range stock {
+			warehouseQty[w.BookCode] = w.NumberOfCopies
+		}
+		for bookCode, qty := range counts {
+			var c stocktakeCount
+			c.recordCount(qty, warehouseQty[bookCode])
+			res := tx.Model(&stocktakeCount{}).
+				Where("stocktake_id = ? AND book_code = ?", id, bookCode).
+				Updates(map[string]interface{}{"counted_qty": c.CountedQty, "system_qty": c.SystemQty})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				problems = append(problems, fmt.Sprintf("книги %d нет на складе", bookCode))
+			} else {
+				saved++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// транзакция откатилась - не сохранено ничего
+		saved = 0
+		problems = append(problems, describeQueryError(ctx, err))
+	}
+	return saved, problems
+}
+
+// countsMessage - итог сохранения подсчета; ✅ только если ошибок не было
+func countsMessage(verb string, saved int, problems []string) string {
+	if len(problems) == 0 {
+		return fmt.Sprintf("✅ %s позиций: %d.", verb, saved)
+	}
+	return fmt.Sprintf("%s позиций: %d. Ошибки: %s", verb, saved, strings.Join(problems, "; "))
+}
+
+// parseCountCSV читает файл подсчета: код книги и количество, разделитель ; или ,
+func parseCountCSV(r io.Reader) (map[int]int, []string) {
+	counts := make(map[int]int)
+	var problems []string
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comma = ';'
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, []string{"Ошибка чтения CSV: " + err.Error()}
+	}
+	for i, rec := range records {
+		if len(rec) == 1 && strings.Contains(rec[0], ",") {
+			rec = strings.Split(rec[0], ",")
+		}
+		if len(rec) < 2 {
+			continue
+		}
+		code := strings.TrimSpace(strings.TrimPrefix(rec[0], "\ufeff"))
+		bookCode, err1 := strconv.Atoi(code)
+		qty, err2 := strconv.Atoi(strings.TrimSpace(rec[1]))
+		if err1 != nil || err2 != nil || qty < 0 {
+			if i == 0 {
+				continue // строка заголовка
+			}
+			problems = append(problems, fmt.Sprintf("строка %d: ожидаются код книги и неотрицательное количество", i+1))
+			continue
+		}
+		counts[bookCode] += qty // одна книга может встречаться на нескольких полках
+	}
+	return counts, problems
+}
+
+// approveStocktake прибавляет расхождения к текущим остаткам склада и записывает каждую корректировку
+// в журнал. Расхождение считается от остатка на момент подсчета, поэтому движения после подсчета
+// сохраняются.
+func approveStocktake(ctx context.Context, id uint) (int, error) {
+	adjusted := 0
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&stocktake{}).Where("id = ? AND status = ?", id, stocktakeOpen).
+			Updates(map[string]interface{}{"status": stocktakeApproved, "approved_by": currentUser, "approved_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("инвентаризация уже закрыта")
+		}
+
+		var counts []stocktakeCount
+		if err := tx.Where("stocktake_id = ? AND counted_qty IS NOT NULL AND counted_qty <> system_qty", id).Find(&counts).Error; err != nil {
+			return err
+		}
+		for _, c := range counts {
+			delta := c.Variance()
+			res := tx.Exec("UPDATE Warehouse SET NumberOfCopies = NumberOfCopies + ? WHERE BookCode = ? AND NumberOfCopies + ? >= 0",
+				delta, c.BookCode, delta)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return fmt.Errorf("корректировка «%s» на %d экз. дает отрицательный остаток", c.Title, delta)
+			}
+			details := fmt.Sprintf("Инвентаризация №%d: учет %d, факт %d, корректировка %+d", id, c.SystemQty, *c.CountedQty, delta)
+			if err := writeAudit(tx, "stocktake_adjust", "Warehouse", strconv.Itoa(c.BookCode), details); err != nil {
+				return err
+			}
+			adjusted++
+		}
+		return writeAudit(tx, "stocktake_approve", "Stocktake", strconv.Itoa(int(id)), fmt.Sprintf("Скорректировано позиций: %d", adjusted))
+	})
+	return adjusted, err
+}
+
+// renderStocktakes выводит список сессий инвентаризации
+func renderStocktakes(ctx context.Context, w http.ResponseWriter, message string) {
+	var sessions []stocktake
+	if err := db().WithContext(ctx).Order("opened_at DESC").Find(&sessions).Error; err != nil {
+		message = "Ошибка получения списка инвентаризаций: " + describeQueryError(ctx, err)
+	}
+	data := map[string]interface{}{
+		"Message":  message,
+		"Sessions": sessions,
+	}
+	if err := tmpl.ExecuteTemplate(w, "stocktake.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderStocktake выводит ввод подсчета и отчет о расхождениях
+func renderStocktake(ctx context.Context, w http.ResponseWriter, id uint, message string) {
+	var st stocktake
+	if err := db().WithContext(ctx).First(&st, id).Error; err != nil {
+		renderStocktakes(ctx, w, "Инвентаризация не найдена: "+describeQueryError(ctx, err))
+		return
+	}
+	var counts []stocktakeCount
+	if err := db().WithContext(ctx).Where("stocktake_id = ?", id).Order("title").Find(&counts).Error; err != nil {
+		message = "Ошибка получения подсчета: " + describeQueryError(ctx, err)
+	}
+
+	var variances []stocktakeCount
+	counted, totalUnits, totalValue := 0, 0, decimal.Zero
+	for _, c := range counts {
+		if c.CountedQty != nil {
+			counted++
+		}
+		if c.Variance() != 0 {
+			variances = append(variances, c)
+			totalUnits += c.Variance()
+			totalValue = totalValue.Add(c.VarianceValue())
+		}
+	}
+	data := map[string]interface{}{
+		"Message":    message,
+		"Session":    st,
+		"Counts":     counts,
+		"Counted":    counted,
+		"Variances":  variances,
+		"TotalUnits": totalUnits,
+		"TotalValue": totalValue,
+	}
+	tmpl.ExecuteTemplate(w, "stocktake_view.html", data)
+}
+
+func registerStocktakeHandlers() {
+	http.HandleFunc("/stocktake", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+		renderStocktakes(ctx, w, "Инвентаризации склада.")
+	})
+
+	http.HandleFunc("/stocktake_open", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderStocktakes(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		st, err := openStocktake(ctx, strings.TrimSpace(r.FormValue("note")))
+		if err != nil {
+			renderStocktakes(ctx, w, "Ошибка открытия инвентаризации: "+describeQueryError(ctx, err))
+			return
+		}
+		renderStocktake(ctx, w, st.ID, "✅ Инвентаризация открыта, учетные остатки зафиксированы.")
+	})
+
+	http.HandleFunc("/stocktake_view", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			renderStocktakes(ctx, w, "Некорректный номер инвентаризации.")
+			return
+		}
+		renderStocktake(ctx, w, uint(id), "")
+	})
+
+	// ввод подсчета вручную: поля count_<код книги>
+	http.HandleFunc("/stocktake_count", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderStocktakes(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("stocktakeID"))
+		counts := make(map[int]int)
+		var problems []string
+		for key, values := range r.PostForm {
+			if !strings.HasPrefix(key, "count_") || strings.TrimSpace(values[0]) == "" {
+				continue
+			}
+			bookCode, err1 := strconv.Atoi(strings.TrimPrefix(key, "count_"))
+			qty, err2 := strconv.Atoi(strings.TrimSpace(values[0]))
+			if err1 != nil || err2 != nil || qty < 0 {
+				problems = append(problems, fmt.Sprintf("некорректное количество для книги %s", strings.TrimPrefix(key, "count_")))
+				continue
+			}
+			counts[bookCode] = qty
+		}
+		saved, saveProblems := saveCounts(ctx, uint(id), counts)
+		renderStocktake(ctx, w, uint(id), countsMessage("Сохранено", saved, append(problems, saveProblems...)))
+	})
+
+	// массовая загрузка подсчета из CSV
+	http.HandleFunc("/stocktake_upload", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseMultipartForm(10 << 20); err != nil || currentRole != "admin" {
+			renderStocktakes(ctx, w, "Ошибка при загрузке файла.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("stocktakeID"))
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			renderStocktake(ctx, w, uint(id), "Выберите CSV-файл.")
+			return
+		}
+		defer file.Close()
+
+		counts, problems := parseCountCSV(file)
+		saved, saveProblems := saveCounts(ctx, uint(id), counts)
+		renderStocktake(ctx, w, uint(id), countsMessage("Загружено", saved, append(problems, saveProblems...)))
+	})
+
+	http.HandleFunc("/stocktake_approve", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderStocktakes(ctx, w, "Утверждать инвентаризацию может только администратор.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("stocktakeID"))
+		adjusted, err := approveStocktake(ctx, uint(id))
+		if err != nil {
+			renderStocktake(ctx, w, uint(id), "Инвентаризация не утверждена: "+describeQueryError(ctx, err))
+			return
+		}
+		renderStocktake(ctx, w, uint(id), fmt.Sprintf("✅ Инвентаризация утверждена, скорректировано позиций: %d.", adjusted))
+	})
+
+	http.HandleFunc("/stocktake_cancel", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		if err := r.ParseForm(); err != nil || currentRole != "admin" {
+			renderStocktakes(ctx, w, "Ошибка при обработке формы.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("stocktakeID"))
+		err := db().WithContext(ctx).Model(&stocktake{}).Where("id = ? AND status = ?", id, stocktakeOpen).
+			Update("status", stocktakeCancelled).Error
+		if err != nil {
+			renderStocktake(ctx, w, uint(id), "Ошибка отмены: "+describeQueryError(ctx, err))
+			return
+		}
+		renderStocktake(ctx, w, uint(id), "Инвентаризация отменена, остатки не изменены.")
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Движения склада между открытием сессии и подсчетом не должны учитываться при утверждении второй раз
+func TestStocktakeMovementsBetweenOpenAndCount(t *testing.T) {
+	tests := []struct {
+		name        string
+		opened      int // остаток при открытии сессии
+		beforeCount int // движение склада между открытием и подсчетом
+		shelf       int // сколько насчитали на полке
+		afterCount  int // движение склада между подсчетом и утверждением
+		want        int // остаток после утверждения
+	}{
+		{"продажа до подсчета", 10, -1, 9, 0, 9},
+		{"поступление до подсчета", 10, 5, 15, 0, 15},
+		{"резерв до подсчета и недостача", 10, -2, 7, 0, 7},
+		{"продажа после подсчета", 10, 0, 10, -1, 9},
+		{"излишек и продажа после подсчета", 10, -1, 11, -3, 8},
+	}
+	for _, tt := range tests {
+		c := stocktakeCount{SystemQty: tt.opened}
+		warehouse := tt.opened + tt.beforeCount
+		c.recordCount(tt.shelf, warehouse)
+		warehouse += tt.afterCount
+		warehouse += c.Variance() // approveStocktake: NumberOfCopies = NumberOfCopies + расхождение
+		if warehouse != tt.want {
+			t.Errorf("%s: остаток после утверждения %d, ожидалось %d", tt.name, warehouse, tt.want)
+		}
+	}
+}
+
+func TestStocktakeVarianceUncounted(t *testing.T) {
+	if v := (stocktakeCount{SystemQty: 5}).Variance(); v != 0 {
+		t.Errorf("Variance без подсчета = %d, want 0", v)
+	}
+}
+
+func TestParseCountCSV(t *testing.T) {
+	counts, problems := parseCountCSV(strings.NewReader("\ufeffкод;количество\n1;5\n2,3\n1;2\nx;1\n3;-1\n"))
+	want := map[int]int{1: 7, 2: 3}
+	if len(counts) != len(want) {
+		t.Errorf("parseCountCSV = %v, want %v", counts, want)
+	}
+	for code, qty := range want {
+		if counts[code] != qty {
+			t.Errorf("книга %d: %d, want %d", code, counts[code], qty)
+		}
+	}
+	if len(problems) != 2 {
+		t.Errorf("ошибки = %q, ожидалось 2 (строки 5 и 6)", problems)
+	}
+}
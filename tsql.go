@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// sqlTokenKind - вид лексемы T-SQL
+type sqlTokenKind int
+
+const (
+	tokWord        sqlTokenKind = iota // ключевое слово или имя без кавычек
+	tokQuotedIdent                     // [имя] или "имя"
+	tokString                          // 'строка' или N'строка'
+	tokNumber
+	tokVariable // @переменная или @@функция
+	tokLParen
+	tokRParen
+	tokSemicolon
+	tokOperator // остальные знаки: , . = < > + - * / % и т.д.
+)
+
+// sqlToken - лексема с позицией (номером символа) в исходном тексте
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+// tokenizeTSQL разбивает текст на лексемы T-SQL, пропуская пробелы и комментарии.
+// Строки, имена в кавычках и комментарии (в том числе вложенные /* */) разбираются по правилам
+// SQL Server, поэтому ключевые слова внутри них не принимаются за операторы.
+func tokenizeTSQL(src string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(src)
+	n := len(runes)
+	for i := 0; i < n; {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < n && runes[i+1] == '-':
+			for i < n && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			depth := 0
+			for i < n {
+				if runes[i] == '/' && i+1 < n && runes[i+1] == '*' {
+					depth++
+					i += 2
+				} else if runes[i] == '*' && i+1 < n && runes[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth > 0 {
+				return nil, fmt.Errorf("строка %d: незакрытый комментарий /*", lineAt(runes, start))
+			}
+		case r == '\'' || (r == 'N' || r == 'n') && i+1 < n && runes[i+1] == '\'':
+			if r != '\'' {
+				i++
+			}
+			end, ok := scanQuoted(runes, i, '\'')
+			if !ok {
+				return nil, fmt.Errorf("строка %d: незакрытая строка", lineAt(runes, start))
+			}
+			i = end
+			tokens = append(tokens, sqlToken{tokString, string(runes[start:i]), start})
+		case r == '[' || r == '"':
+			closing := ']'
+			if r == '"' {
+				closing = '"'
+			}
+			end, ok := scanQuoted(runes, i, closing)
+			if !ok {
+				return nil, fmt.Errorf("строка %d: незакрытое имя %c...%c", lineAt(runes, start), r, closing)
+			}
+			i = end
+			tokens = append(tokens, sqlToken{tokQuotedIdent, string(runes[start:i]), start})
+		case r == '0' && i+1 < n && (runes[i+1] == 'x' || runes[i+1] == 'X'):
+			// Двоичная константа 0x...: только шестнадцатеричные цифры
+			i += 2
+			for i < n && isHexDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokNumber, string(runes[start:i]), start})
+		case isASCIIDigit(r) || r == '.' && i+1 < n && isASCIIDigit(runes[i+1]):
+			// Число - цифры, точка и порядок e[+-]цифры. Любая другая буква заканчивает число, как и на
+			// сервере: в "1DELETE" после числа 1 идет слово DELETE.
+			for i < n && (isASCIIDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < n && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < n && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < n && isASCIIDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, sqlToken{tokNumber, string(runes[start:i]), start})
+		case isWordStart(r):
+			i++
+			for i < n && isWordPart(runes[i]) {
+				i++
+			}
+			kind := tokWord
+			if r == '@' {
+				kind = tokVariable
+			}
+			tokens = append(tokens, sqlToken{kind, string(runes[start:i]), start})
+		case r == '(':
+			i++
+			tokens = append(tokens, sqlToken{tokLParen, "(", start})
+		case r == ')':
+			i++
+			tokens = append(tokens, sqlToken{tokRParen, ")", start})
+		case r == ';':
+			i++
+			tokens = append(tokens, sqlToken{tokSemicolon, ";", start})
+		default:
+			i++
+			tokens = append(tokens, sqlToken{tokOperator, string(r), start})
+		}
+	}
+	return tokens, nil
+}
+
+// scanQuoted ищет закрывающую кавычку; удвоенная кавычка внутри - экранированный символ
+func scanQuoted(runes []rune, i int, closing rune) (int, bool) {
+	for i++; i < len(runes); i++ {
+		if runes[i] == closing {
+			if i+1 < len(runes) && runes[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return i, false
+}
+
+func isASCIIDigit(r rune) bool { return r >= '0' && r <= '9' }
+
+func isHexDigit(r rune) bool {
+	return isASCIIDigit(r) || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+func isWordStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@' || r == '#'
+}
+
+func isWordPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@' || r == '#' || r == '$'
+}
+
+// lineAt - номер строки символа для сообщений об ошибках
+func lineAt(runes []rune, pos int) int {
+	line := 1
+	for _, r := range runes[:pos] {
+		if r == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// statementVerbs - зарезервированные слова T-SQL, с которых начинаются изменяющие операторы,
+// управление транзакциями и курсорами и обращения за пределы базы. T-SQL не требует точки с запятой
+// между операторами, поэтому такое слово после выражения («SELECT 1 DELETE ...») начинает новый
+// оператор. Именем без квадратных скобок оно быть не может, и сервер отклонит такой пакет целиком.
+var statementVerbs = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "TRUNCATE": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "GRANT": true, "REVOKE": true, "DENY": true,
+	"EXEC": true, "EXECUTE": true, "BEGIN": true, "COMMIT": true, "ROLLBACK": true, "SAVE": true,
+	"SET": true, "DECLARE": true, "USE": true,
+	"BACKUP": true, "RESTORE": true, "DBCC": true, "BULK": true, "CHECKPOINT": true, "KILL": true,
+	"SHUTDOWN": true, "RECONFIGURE": true, "WAITFOR": true, "SETUSER": true, "REVERT": true,
+	"OPEN": true, "FETCH": true, "CLOSE": true, "DEALLOCATE": true,
+	"READTEXT": true, "WRITETEXT": true, "UPDATETEXT": true,
+	"PRINT": true, "RAISERROR": true, "GOTO": true, "RETURN": true,
+}
+
+// unreservedVerbs - незарезервированные слова, начинающие оператор Service Broker или триггера.
+// Они допустимы как имена и псевдонимы, поэтому считаются оператором, только если за ними идет
+// слово, без которого оператор не пишется.
+var unreservedVerbs = map[string]func(next string) bool{
+	"SEND":    func(next string) bool { return next == "ON" },
+	"MOVE":    func(next string) bool { return next == "CONVERSATION" },
+	"ENABLE":  func(next string) bool { return next == "TRIGGER" },
+	"DISABLE": func(next string) bool { return next == "TRIGGER" },
+	// RECEIVE [TOP (n)] столбцы FROM очередь: за псевдонимом RECEIVE идет запятая, FROM или конец
+	"RECEIVE": func(next string) bool {
+		return next != "" && next != "," && next != "FROM" && next != ";" && next != ")"
+	},
+}
+
+// rowsetFunctions - функции, обращающиеся к другим серверам и файлам; запрещены в любом месте
+var rowsetFunctions = map[string]bool{
+	"OPENROWSET": true, "OPENDATASOURCE": true, "OPENQUERY": true,
+}
+
+// nameContext - слова, после которых ожидается выражение или имя. Оператор здесь начаться не может,
+// поэтому зарезервированное слово после них - имя столбца или псевдоним, а не новый оператор.
+var nameContext = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "AS": true, "FROM": true, "JOIN": true, "ON": true, "WHERE": true,
+	"AND": true, "OR": true, "NOT": true, "BY": true, "HAVING": true, "WHEN": true, "THEN": true, "LIKE": true,
+}
+
+// selectListEnd - слова, которыми заканчивается список столбцов SELECT
+var selectListEnd = map[string]bool{
+	"FROM": true, "WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true,
+	"UNION": true, "EXCEPT": true, "INTERSECT": true, "OPTION": true, "FOR": true,
+}
+
+// startsStatement проверяет, начинает ли слово tokens[i] новый оператор: предыдущая лексема не
+// требует продолжения выражения (ELSE, метка и закрытое выражение тоже считаются концом оператора)
+func startsStatement(tokens []sqlToken, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := tokens[i-1]
+	switch prev.kind {
+	case tokWord:
+		return !nameContext[strings.ToUpper(prev.text)]
+	case tokLParen:
+		return false
+	case tokOperator:
+		return prev.text == "*" || prev.text == ":"
+	}
+	return true
+}
+
+// lockHints - табличные подсказки, которые берут блокировки, несмотря на изоляцию SNAPSHOT:
+// монопольные и на обновление останавливают запись в таблицу, а HOLDLOCK и подобные
+// удерживают блокировки до конца транзакции консоли
+var lockHints = map[string]bool{
+	"TABLOCK": true, "TABLOCKX": true, "XLOCK": true, "UPDLOCK": true, "HOLDLOCK": true,
+	"PAGLOCK": true, "SERIALIZABLE": true, "REPEATABLEREAD": true, "READCOMMITTEDLOCK": true,
+}
+
+// checkReadOnlySQL проверяет, что пакет состоит только из запросов на чтение: каждый оператор
+// начинается с SELECT или WITH (или скобки), после выражения не начинается изменяющий оператор,
+// в списке столбцов нет INTO, нет подсказок блокировки и NEXT VALUE FOR, скобки сбалансированы.
+// Это разбор на уровне лексем, а не полный синтаксический анализ: консоль дополнительно выполняет
+// пакет в транзакции SNAPSHOT и всегда откатывает ее.
+func checkReadOnlySQL(src string) error {
+	tokens, err := tokenizeTSQL(src)
+	if err != nil {
+		return err
+	}
+	runes := []rune(src)
+	line := func(t sqlToken) int { return lineAt(runes, t.pos) }
+	upper := func(i int) string {
+		if i < 0 || i >= len(tokens) {
+			return ""
+		}
+		if tokens[i].kind == tokWord {
+			return strings.ToUpper(tokens[i].text)
+		}
+		return tokens[i].text
+	}
+
+	statements := 0
+	expectStart := true
+	// selectList[d] - на глубине скобок d идет список столбцов SELECT
+	selectList := []bool{false}
+	for i, t := range tokens {
+		word := ""
+		if t.kind == tokWord {
+			word = strings.ToUpper(t.text)
+		}
+		if expectStart && t.kind != tokSemicolon {
+			if word != "SELECT" && word != "WITH" && t.kind != tokLParen {
+				return fmt.Errorf("строка %d: оператор начинается с %q, разрешены только запросы SELECT", line(t), t.text)
+			}
+			statements++
+			expectStart = false
+		}
+		depth := len(selectList) - 1
+		switch {
+		case statementVerbs[word] && startsStatement(tokens, i):
+			return fmt.Errorf("строка %d: %s запрещено, консоль только читает данные", line(t), word)
+		case unreservedVerbs[word] != nil && startsStatement(tokens, i) && unreservedVerbs[word](upper(i+1)):
+			return fmt.Errorf("строка %d: %s запрещено, консоль только читает данные", line(t), word)
+		case rowsetFunctions[word]:
+			return fmt.Errorf("строка %d: %s запрещено, консоль читает только данные этой базы", line(t), word)
+		case word == "INTO" && selectList[depth]:
+			return fmt.Errorf("строка %d: SELECT ... INTO создает таблицу, консоль только читает данные", line(t))
+		case lockHints[word]:
+			return fmt.Errorf("строка %d: подсказка блокировки %s запрещена", line(t), word)
+		case word == "NEXT" && upper(i+1) == "VALUE":
+			return fmt.Errorf("строка %d: NEXT VALUE FOR изменяет последовательность", line(t))
+		case word == "GO" && (i == 0 || line(tokens[i-1]) < line(t)) && (i+1 == len(tokens) || line(tokens[i+1]) > line(t)):
+			return fmt.Errorf("строка %d: разделитель пакетов GO не поддерживается, используйте ;", line(t))
+		case word == "SELECT":
+			selectList[depth] = true
+		case selectListEnd[word]:
+			selectList[depth] = false
+		case t.kind == tokLParen:
+			selectList = append(selectList, false)
+		case t.kind == tokRParen:
+			if depth == 0 {
+				return fmt.Errorf("строка %d: лишняя закрывающая скобка", line(t))
+			}
+			selectList = selectList[:depth]
+		case t.kind == tokSemicolon:
+			if depth > 0 {
+				return fmt.Errorf("строка %d: точка с запятой внутри скобок", line(t))
+			}
+			selectList[0] = false
+			expectStart = true
+		}
+	}
+	if len(selectList) > 1 {
+		return errors.New("не закрыта скобка")
+	}
+	if statements == 0 {
+		return errors.New("запрос пуст")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import "testing"
+
+func TestTokenizeTSQLNumbers(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"1DELETE", []string{"1", "DELETE"}},
+		{"12.5e+3x", []string{"12.5e+3", "x"}},
+		{"1eDELETE", []string{"1e", "DELETE"}},
+		{".5", []string{".5"}},
+		{"0x1DEFG", []string{"0x1DEF", "G"}},
+		{"a1DELETE", []string{"a1DELETE"}},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenizeTSQL(tt.src)
+		if err != nil {
+			t.Errorf("tokenizeTSQL(%q): %v", tt.src, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens {
+			got = append(got, tok.text)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("tokenizeTSQL(%q) = %q, want %q", tt.src, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("tokenizeTSQL(%q) = %q, want %q", tt.src, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCheckReadOnlySQLAllows(t *testing.T) {
+	for _, src := range []string{
+		"SELECT 1",
+		"select * from Sales where Quantity > 1;",
+		"SELECT 1; SELECT 2;",
+		"(SELECT 1) UNION SELECT 2",
+		"WITH x AS (SELECT 1 AS a) SELECT * FROM x",
+		"SELECT 1e5, .5, 1.e-3, 0x1DE",
+		"SELECT N'DELETE FROM Sales', 'it''s'",
+		"SELECT [DELETE], [a]]DELETE], \"INSERT\" FROM t",
+		"SELECT 1 -- DELETE FROM Sales",
+		"SELECT 1 /* /* */ DELETE FROM Sales */",
+		"SELECT * FROM Sales WITH (NOLOCK)",
+		"SELECT @@ROWCOUNT, @@SPID",
+		// слова операторов в роли имен и псевдонимов
+		"SELECT Open FROM t",
+		"SELECT 1 AS Close, 2 AS Move, 3 AS Send, 4 AS Save, 5 AS [Return], 6 AS Print",
+		"SELECT t.Save, t.Return FROM t WHERE Print = 1 AND Open > 0",
+		"SELECT Quantity Move, Price Send, BookID Receive FROM Sales",
+		"SELECT a Receive, b Disable FROM t",
+		"SELECT 1 AS Go",
+		"SELECT Go FROM t",
+		"SELECT Name FROM Books WHERE Name LIKE 'a' ORDER BY Name DESC",
+		"SELECT CASE WHEN Quantity > 1 THEN Open ELSE 0 END FROM Sales",
+		"SELECT * FROM Sales WHERE BookID IN (SELECT BookCode FROM Books)",
+	} {
+		if err := checkReadOnlySQL(src); err != nil {
+			t.Errorf("checkReadOnlySQL(%q): %v", src, err)
+		}
+	}
+}
+
+func TestCheckReadOnlySQLRejects(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"  -- только комментарий",
+		"DELETE FROM Sales",
+		// слово, приклеенное к числу
+		"SELECT 1DELETE FROM Sales",
+		"SELECT 1COMMIT SELECT 1DELETE FROM Sales",
+		"SELECT 1.5e3DELETE FROM Sales",
+		"SELECT 1eDELETE FROM Sales",
+		"SELECT 0x1SET ROWCOUNT 0",
+		// вложенные комментарии закрываются парами
+		"SELECT 1 /* /* */ */ DELETE FROM Sales",
+		"SELECT 1 /* /* */",
+		// строки и имена
+		"SELECT N'it''s' DELETE FROM Sales",
+		"SELECT 'a",
+		"SELECT [a] DELETE FROM Sales",
+		"SELECT [a",
+		// изменяющие конструкции внутри SELECT
+		"SELECT * INTO #t FROM Sales",
+		"SELECT a, b INTO t",
+		"SELECT * FROM (SELECT a INTO t FROM s) x",
+		"SELECT a FROM t UNION SELECT b INTO u FROM v",
+		// оператор после выражения без точки с запятой
+		"SELECT a Open cur",
+		"SELECT 1 PRINT 'x'",
+		"SELECT * RETURN",
+		"SELECT 1 SAVE TRAN x",
+		"SELECT 1 SEND ON CONVERSATION @h",
+		"SELECT 1 MOVE CONVERSATION @h TO @g",
+		"SELECT 1 DISABLE TRIGGER tr ON Sales",
+		"SELECT 1 RECEIVE * FROM q",
+		"SELECT 1 IF 1 = 1 SELECT 2 ELSE DELETE FROM Sales",
+		"SELECT 1 lbl: DELETE FROM Sales",
+		"SELECT NEXT VALUE FOR dbo.seq",
+		"WITH x AS (SELECT 1 AS a) DELETE FROM Sales",
+		"WITH x AS (SELECT 1 AS a) UPDATE Sales SET Quantity = 0",
+		"SELECT 1 MERGE Sales AS s USING x ON 1 = 1 WHEN MATCHED THEN DELETE;",
+		"EXEC('DELETE FROM Sales')",
+		"SELECT 1 WAITFOR DELAY '00:01'",
+		"SELECT * FROM OPENROWSET('SQLNCLI', 'x', 'SELECT 1')",
+		"SELECT 1; BEGIN TRAN",
+		// подсказки блокировки
+		"SELECT * FROM Sales WITH (TABLOCKX)",
+		"SELECT * FROM Sales WITH (xlock, rowlock)",
+		"SELECT * FROM Sales WITH (UPDLOCK)",
+		"SELECT * FROM Sales (HOLDLOCK)",
+		// структура пакета
+		"SELECT 1\nGO",
+		"SELECT (1",
+		"SELECT 1)",
+		"SELECT (1; SELECT 2)",
+	} {
+		if err := checkReadOnlySQL(src); err == nil {
+			t.Errorf("checkReadOnlySQL(%q): ожидалась ошибка", src)
+		}
+	}
+}
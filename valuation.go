@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// inventorySnapshot - остаток и цена книги на складе на дату снимка
+type inventorySnapshot struct {
+	ID             uint      `gorm:"primaryKey"`
+	SnapshotDate   time.Time `gorm:"type:date;uniqueIndex:idx_inventory_snapshot"`
+	BookCode       int       `gorm:"uniqueIndex:idx_inventory_snapshot"`
+	PublisherCode  int
+	ClassifierCode string          `gorm:"size:50"`
+	Price          decimal.Decimal `gorm:"type:decimal(18,2)"`
+	NumberOfCopies int
+}
+
+func (inventorySnapshot) TableName() string { return "app_inventory_snapshots" }
+
+func init() {
+	registerModels(&inventorySnapshot{})
+}
+
+// takeInventorySnapshot сохраняет состояние Warehouse на дату, заменяя снимок, если он уже был сделан
+func takeInventorySnapshot(ctx context.Context, date time.Time) (int64, error) {
+	var saved int64
+	err := db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("snapshot_date = ?", date).Delete(&inventorySnapshot{}).Error; err != nil {
+			return err
+		}
+		res := tx.Exec(`
+            INSERT INTO app_inventory_snapshots (snapshot_date, book_code, publisher_code, classifier_code, price, number_of_copies)
+            SELECT CAST(? AS date), w.BookCode, b.PublisherCode, COALESCE(CAST(b.ClassifierCode AS nvarchar(50)), ''),
+                   w.Price, w.NumberOfCopies
+            FROM Warehouse w
+            LEFT JOIN Books b ON b.BookCode = w.BookCode`, date)
+		saved = res.RowsAffected
+		return res.Error
+	})
+	return saved, err
+}
+
+// nextSnapshotTime возвращает ближайший момент ежедневного снимка после now
+func nextSnapshotTime(now time.Time) time.Time {
+	y, m, d := now.Date()
+	next := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Add(config.Valuation.snapshotTime)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// runSnapshotScheduler раз в день делает снимок склада. До первого подключения к базе снимок пропускается.
+func runSnapshotScheduler() {
+	for {
+		time.Sleep(time.Until(nextSnapshotTime(time.Now())))
+		if db() == nil {
+			fmt.Println("Снимок склада пропущен: нет подключения к базе")
+			continue
+		}
+		y, m, d := time.Now().Date()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		saved, err := takeInventorySnapshot(ctx, time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+		cancel()
+		if err != nil {
+			fmt.Println("Ошибка снимка склада:", err)
+			continue
+		}
+		fmt.Println("Снимок склада сохранен, позиций:", saved)
+	}
+}
+
+// snapshotDateFor возвращает дату последнего снимка не позже date
+func snapshotDateFor(ctx context.Context, date time.Time) (time.Time, error) {
+	var found sql.NullTime
+	row := db().WithContext(ctx).Raw("SELECT MAX(snapshot_date) FROM app_inventory_snapshots WHERE snapshot_date <= ?", date).Row()
+	if err := row.Scan(&found); err != nil {
+		return time.Time{}, err
+	}
+	if !found.Valid {
+		return time.Time{}, errors.New("на " + date.Format("2006-01-02") + " и раньше снимков склада нет")
+	}
+	return found.Time, nil
+}
+
+// valuationGrouping - разрез оценки склада
+type valuationGrouping struct {
+	Title   string
+	Key     string
+	Label   string
+	GroupBy string
+}
+
+var valuationGroupings = map[string]valuationGrouping{
+	"book":       {Title: "Книга", Key: "CAST(v.book_code AS nvarchar(50))", Label: "COALESCE(b.Name, '')", GroupBy: "v.book_code, b.Name"},
+	"publisher":  {Title: "Издательство", Key: "CAST(v.publisher_code AS nvarchar(50))", Label: "COALESCE(p.Name, '')", GroupBy: "v.publisher_code, p.Name"},
+	"classifier": {Title: "Раздел", Key: "v.classifier_code", Label: "COALESCE(c.Name, '')", GroupBy: "v.classifier_code, c.Name"},
+}
+
+// valuationRow - стоимость остатков в одном разрезе на одну или две даты
+type valuationRow struct {
+	Key     string
+	Label   string
+	Copies  int
+	Value   decimal.Decimal
+	Copies2 int
+	Value2  decimal.Decimal
+}
+
+// CopiesDiff - изменение числа экземпляров ко второй дате
+func (r valuationRow) CopiesDiff() int { return r.Copies2 - r.Copies }
+
+// ValueDiff - изменение стоимости ко второй дате
+func (r valuationRow) ValueDiff() decimal.Decimal { return r.Value2.Sub(r.Value) }
+
+// loadValuation возвращает стоимость остатков по снимку на дату в разрезе by
+func loadValuation(ctx context.Context, date time.Time, by string) ([]valuationRow, error) {
+	g := valuationGroupings[by]
+	var rows []valuationRow
+	err := db().WithContext(ctx).Raw(`
+        SELECT `+g.Key+` AS [Key], `+g.Label+` AS Label,
+               SUM(v.number_of_copies) AS Copies, SUM(v.price * v.number_of_copies) AS Value
+        FROM app_inventory_snapshots v
+        LEFT JOIN Books b ON b.BookCode = v.book_code
+        LEFT JOIN Publishers p ON p.PublisherCode = v.publisher_code
+        LEFT JOIN Classifier c ON CAST(c.ClassifierCode AS nvarchar(50)) = v.classifier_code
+        WHERE v.snapshot_date = ?
+        GROUP BY `+g.GroupBy, date).Scan(&rows).Error
+	return rows, err
+}
+
+// compareValuations сводит оценки на две даты по ключу разреза
+func compareValuations(first, second []valuationRow) []valuationRow {
+	rows := append([]valuationRow(nil), first...)
+	byKey := make(map[string]*valuationRow, len(rows))
+	for i := range rows {
+		byKey[rows[i].Key] = &rows[i]
+	}
+	for _, r := range second {
+		if existing, ok := byKey[r.Key]; ok {
+			existing.Copies2, existing.Value2 = r.Copies, r.Value
+			continue
+		}
+		rows = append(rows, valuationRow{Key: r.Key, Label: r.Label, Copies2: r.Copies, Value2: r.Value})
+	}
+	return rows
+}
+
+// valuationTotal суммирует строки оценки
+func valuationTotal(rows []valuationRow) valuationRow {
+	total := valuationRow{Label: "Итого"}
+	for _, r := range rows {
+		total.Copies += r.Copies
+		total.Value = total.Value.Add(r.Value)
+		total.Copies2 += r.Copies2
+		total.Value2 = total.Value2.Add(r.Value2)
+	}
+	return total
+}
+
+// valuationRequest - параметры страницы оценки склада
+type valuationRequest struct {
+	Date    time.Time
+	Compare *time.Time
+	By      string
+}
+
+func (v valuationRequest) DateString() string { return v.Date.Format("2006-01-02") }
+
+func (v valuationRequest) CompareString() string {
+	if v.Compare == nil {
+		return ""
+	}
+	return v.Compare.Format("2006-01-02")
+}
+
+// parseValuationRequest читает дату, дату сравнения и разрез; по умолчанию - сегодня по книгам
+func parseValuationRequest(q url.Values) (valuationRequest, error) {
+	y, m, d := time.Now().Date()
+	req := valuationRequest{Date: time.Date(y, m, d, 0, 0, 0, 0, time.UTC), By: q.Get("by")}
+	if _, ok := valuationGroupings[req.By]; !ok {
+		req.By = "book"
+	}
+	var err error
+	if v := q.Get("date"); v != "" {
+		if req.Date, err = time.Parse("2006-01-02", v); err != nil {
+			return req, fmt.Errorf("дата: ожидается дата в формате ГГГГ-ММ-ДД")
+		}
+	}
+	if v := q.Get("compare"); v != "" {
+		compare, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return req, fmt.Errorf("дата сравнения: ожидается дата в формате ГГГГ-ММ-ДД")
+		}
+		req.Compare = &compare
+	}
+	return req, nil
+}
+
+// buildValuation находит снимки на запрошенные даты и считает оценку; при сравнении Copies/Value
+// относятся к первой дате, Copies2/Value2 - ко второй
+func buildValuation(ctx context.Context, req valuationRequest) (rows []valuationRow, snapshots []time.Time, err error) {
+	first, err := snapshotDateFor(ctx, req.Date)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rows, err = loadValuation(ctx, first, req.By); err != nil {
+		return nil, nil, err
+	}
+	snapshots = append(snapshots, first)
+	if req.Compare != nil {
+		second, err := snapshotDateFor(ctx, *req.Compare)
+		if err != nil {
+			return nil, nil, err
+		}
+		compared, err := loadValuation(ctx, second, req.By)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = compareValuations(rows, compared)
+		snapshots = append(snapshots, second)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Label < rows[j].Label })
+	return rows, snapshots, nil
+}
+
+// valuationResultSet представляет оценку таблицей для выгрузки
+func valuationResultSet(req valuationRequest, rows []valuationRow, snapshots []time.Time) *resultSet {
+	g := valuationGroupings[req.By]
+	rs := &resultSet{
+		Title:      "Оценка склада на " + snapshots[0].Format("2006-01-02"),
+		Columns:    []string{"Код", g.Title, "Экземпляров", "Стоимость"},
+		BookColumn: -1,
+	}
+	if len(snapshots) > 1 {
+		rs.Title += " и " + snapshots[1].Format("2006-01-02")
+		rs.Columns = append(rs.Columns, "Экземпляров (2)", "Стоимость (2)", "Изменение экз.", "Изменение стоимости")
+	}
+	for _, r := range append(rows, valuationTotal(rows)) {
+		record := []interface{}{r.Key, r.Label, r.Copies, r.Value.StringFixed(2)}
+		if len(snapshots) > 1 {
+			record = append(record, r.Copies2, r.Value2.StringFixed(2), r.CopiesDiff(), r.ValueDiff().StringFixed(2))
+		}
+		rs.Rows = append(rs.Rows, record)
+	}
+	return rs
+}
+
+// renderValuation выводит оценку склада на дату или сравнение двух дат
+func renderValuation(ctx context.Context, w http.ResponseWriter, req valuationRequest, message string) {
+	data := map[string]interface{}{
+		"Message":   message,
+		"Request":   req,
+		"IsAdmin":   currentRole == "admin",
+		"Groupings": valuationGroupings,
+	}
+	rows, snapshots, err := buildValuation(ctx, req)
+	if err != nil {
+		data["Message"] = strings.TrimSpace(message + " Оценка недоступна: " + describeQueryError(ctx, err))
+	} else {
+		data["Rows"] = rows
+		data["Total"] = valuationTotal(rows)
+		data["Snapshots"] = snapshots
+		data["Title"] = valuationGroupings[req.By].Title
+	}
+	if err := tmpl.ExecuteTemplate(w, "valuation.html", data); err != nil {
+		http.Error(w, "Ошибка выполнения шаблона: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func registerValuationHandlers() {
+	http.HandleFunc("/valuation", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		q := r.URL.Query()
+		req, err := parseValuationRequest(q)
+		if err != nil {
+			req, _ = parseValuationRequest(url.Values{})
+			renderValuation(ctx, w, req, "Ошибка в параметрах: "+err.Error())
+			return
+		}
+		if q.Get("format") != "csv" {
+			renderValuation(ctx, w, req, "")
+			return
+		}
+		rows, snapshots, err := buildValuation(ctx, req)
+		if err != nil {
+			renderValuation(ctx, w, req, "Оценка недоступна: "+describeQueryError(ctx, err))
+			return
+		}
+		setDownloadHeaders(w, "valuation_"+req.By+"_"+snapshots[0].Format("20060102")+".csv", "text/csv; charset=utf-8")
+		writeCSV(w, []*resultSet{valuationResultSet(req, rows, snapshots)})
+	})
+
+	// снимок вне расписания, например перед инвентаризацией
+	http.HandleFunc("/valuation_snapshot", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := queryContext(r)
+		defer cancel()
+
+		req, _ := parseValuationRequest(url.Values{})
+		if r.Method != http.MethodPost || currentRole != "admin" {
+			renderValuation(ctx, w, req, "Ошибка при обработке формы.")
+			return
+		}
+		saved, err := takeInventorySnapshot(ctx, req.Date)
+		if err != nil {
+			renderValuation(ctx, w, req, "Ошибка снимка склада: "+describeQueryError(ctx, err))
+			return
+		}
+		renderValuation(ctx, w, req, fmt.Sprintf("✅ Снимок склада на %s сохранен, позиций: %d.", req.DateString(), saved))
+	})
+}